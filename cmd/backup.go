@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// backupRepos mirrors the org's repos, or those selected with the repo filters,
+// into dir, pulling repositories.json first if needed. Each repo's last synced
+// commit is recorded in manifest.json in dir.
+func backupRepos(ctx context.Context, dir string) error {
+	if _, err := os.Stat(path.Join(client.DataDir, "repositories.json")); os.IsNotExist(err) {
+		pullRepositories(ctx)
+	}
+	var rs []*ghapi.Repository
+	var err error
+	if *repoNames != "" || *repoTopic != "" || *repoTeam != "" || *repoLanguage != "" {
+		var ts []*ghapi.Team
+		if *repoTeam != "" {
+			if ts, err = client.LoadTeams(); err != nil {
+				return err
+			}
+		}
+		rs, err = selectRepos(ts)
+	} else {
+		rs, err = client.LoadRepositories()
+	}
+	if err != nil {
+		return err
+	}
+	var brs []*ghapi.Repository
+	for _, r := range rs {
+		if *skipArchived && r.Archived {
+			log.Printf("Skipping archived repo: %s\n", r.Name)
+			continue
+		}
+		brs = append(brs, r)
+	}
+	log.Printf("Backing up %d repos to %s\n", len(brs), dir)
+	if *dryRun {
+		for _, r := range brs {
+			planBackup(dir, r.Name, "repo", r.Name+".git")
+			if r.HasWiki {
+				planBackup(dir, r.Name, "wiki", r.Name+".wiki.git")
+			}
+		}
+		return nil
+	}
+	recs, berr := client.BackupRepositoriesContext(ctx, brs, dir)
+	if berr != nil {
+		return berr
+	}
+	var failed []*ghapi.BackupRecord
+	for _, br := range recs {
+		if br.Error != "" {
+			failed = append(failed, br)
+		}
+	}
+	fmt.Printf("Backed up: %d\n", len(recs)-len(failed))
+	if len(failed) > 0 {
+		fmt.Printf("Failed: %d\n", len(failed))
+		for _, br := range failed {
+			fmt.Printf("  %s: %s\n", br.Repository, br.Error)
+		}
+		return fmt.Errorf("%d repos failed to back up", len(failed))
+	}
+	return nil
+}
+
+// planBackup records whether the mirror of kind, repo or wiki, at p in dir would be cloned or fetched
+func planBackup(dir, repo, kind, p string) {
+	action := "clone_" + kind
+	if _, err := os.Stat(path.Join(dir, p)); err == nil {
+		action = "fetch_" + kind
+	}
+	plan = append(plan, &planStep{
+		Action:     action,
+		Repository: repo,
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// batchLogins returns the logins selected by -migrate-team, -migrate-file or
+// -migrate-all, in order and without duplicates
+func batchLogins(s *ghapi.Snapshot) ([]string, error) {
+	var ls []string
+	switch {
+	case *migrateTeam != "":
+		t := s.Team(*migrateTeam)
+		if t == nil {
+			return nil, errors.New("team " + *migrateTeam + " not found in teams.json")
+		}
+		for _, u := range t.Members {
+			ls = append(ls, u.Login)
+		}
+	case *migrateFile != "":
+		fl, err := readLoginFile(*migrateFile)
+		if err != nil {
+			return nil, err
+		}
+		ls = fl
+	case *migrateAll:
+		for _, u := range s.Users {
+			ls = append(ls, u.Login)
+		}
+	}
+	seen := make(map[string]bool)
+	var bl []string
+	for _, l := range ls {
+		k := strings.ToLower(l)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		bl = append(bl, l)
+	}
+	return bl, nil
+}
+
+// skipProtected removes from ls the user self the token belongs to, as removing
+// them from the org would stop the batch, and the org admins in s unless admins
+// is set, as an admin's removal takes away their control of the org
+func skipProtected(ls []string, s *ghapi.Snapshot, self string, admins bool) []string {
+	roles := make(map[string]string)
+	for _, m := range s.Memberships {
+		roles[strings.ToLower(m.User.Login)] = m.Role
+	}
+	var kl []string
+	for _, l := range ls {
+		if strings.EqualFold(l, self) {
+			log.Printf("Skipping %s, the user the token belongs to\n", l)
+			continue
+		}
+		if !admins && roles[strings.ToLower(l)] == "admin" {
+			log.Printf("Skipping org admin %s, set -migrate-admins to migrate admins\n", l)
+			continue
+		}
+		kl = append(kl, l)
+	}
+	return kl
+}
+
+// readLoginFile reads one login per line. Blank lines and lines starting with #
+// are skipped, and only the first field of a CSV line such as migrated.csv is used.
+func readLoginFile(f string) ([]string, error) {
+	fd, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var ls []string
+	sc := bufio.NewScanner(fd)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		l = strings.TrimSpace(strings.Split(l, ",")[0])
+		if l != "" {
+			ls = append(ls, l)
+		}
+	}
+	return ls, sc.Err()
+}
+
+// migrateBatch migrates the users selected for a batch one at a time, stopping
+// once more than -max-failures users have failed, and prints a summary
+func migrateBatch(ctx context.Context) error {
+	s, serr := loadSnapshot()
+	if serr != nil {
+		return serr
+	}
+	lg, lerr := client.LoadLedger()
+	if lerr != nil {
+		return lerr
+	}
+	ls, berr := batchLogins(s)
+	if berr != nil {
+		return berr
+	}
+	me, merr := client.AuthenticatedUserContext(ctx)
+	if merr != nil {
+		return merr
+	}
+	ls = skipProtected(ls, s, me.Login, *migrateAdmins)
+	log.Printf("Migrating %d users\n", len(ls))
+	var migrated, pending, attempted []string
+	failed := make(map[string]error)
+	var failedOrder []string
+	for i, l := range ls {
+		if ctx.Err() != nil {
+			break
+		}
+		if *maxFailures >= 0 && len(failedOrder) > *maxFailures {
+			log.Printf("More than %d users failed, stopping\n", *maxFailures)
+			break
+		}
+		log.Printf("[%d/%d] Migrating user: %s\n", i+1, len(ls), l)
+		attempted = append(attempted, l)
+		err := migrateUser(ctx, lg, ghapi.User{Login: l})
+		if err != nil {
+			log.Printf("[%d/%d] Migration of %s failed: %v\n", i+1, len(ls), l, err)
+			failed[l] = err
+			failedOrder = append(failedOrder, l)
+			continue
+		}
+		if *dryRun {
+			continue
+		}
+		rec := lg.Record(l)
+		if rec.Done() {
+			migrated = append(migrated, l)
+		} else {
+			pending = append(pending, l)
+		}
+	}
+	if *dryRun {
+		if len(failedOrder) > 0 {
+			return fmt.Errorf("%d of %d users could not be planned", len(failedOrder), len(attempted))
+		}
+		return ctx.Err()
+	}
+	fmt.Printf("Migrated: %d\n", len(migrated))
+	fmt.Printf("Awaiting acceptance: %d\n", len(pending))
+	for _, l := range pending {
+		fmt.Printf("  %s\n", l)
+	}
+	fmt.Printf("Failed: %d\n", len(failedOrder))
+	for _, l := range failedOrder {
+		fmt.Printf("  %s: %v\n", l, failed[l])
+	}
+	if n := len(ls) - len(attempted); n > 0 {
+		fmt.Printf("Not attempted: %d\n", n)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failedOrder) > 0 {
+		return fmt.Errorf("%d of %d users failed to migrate", len(failedOrder), len(attempted))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+func TestSkipProtected(t *testing.T) {
+	s := &ghapi.Snapshot{
+		Memberships: []*ghapi.Membership{
+			member("Owner", "admin"),
+			member("alice", "admin"),
+			member("bob", "member"),
+		},
+	}
+	ls := []string{"bob", "owner", "Alice", "carol"}
+	tests := []struct {
+		name   string
+		admins bool
+		want   []string
+	}{
+		{"admins skipped", false, []string{"bob", "carol"}},
+		{"admins migrated", true, []string{"bob", "Alice", "carol"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skipProtected(ls, s, "OWNER", tt.admins); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("skipProtected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
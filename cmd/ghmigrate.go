@@ -1,39 +1,119 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/umg/devops-github-migrate/ghapi"
 )
 
 var (
-	migrate  *string
-	remove   *string
-	org      *string
-	team     *string
-	dataDir  *string
-	token    *string
-	pull     *bool
-	pullType *string
-	users    *bool
-	userData *string
-	teams    *bool
+	migrate        *string
+	migrateTeam    *string
+	migrateFile    *string
+	migrateAll     *bool
+	migrateAdmins  *bool
+	maxFailures    *int
+	remove         *string
+	rollbackTo     *string
+	reconcileOn    *bool
+	reconcileFile  *string
+	invites        *string
+	staleDays      *int
+	outside        *string
+	replicate      *bool
+	teamRepos      *bool
+	transfer       *bool
+	transferRename *bool
+	repoNames      *string
+	backupDir      *string
+	stateAction    *string
+	stateFile      *string
+	skipArchived   *bool
+	repoTopic      *string
+	repoTeam       *string
+	repoLanguage   *string
+	outsideUsers   *string
+	dryRun         *bool
+	planFile       *string
+	org            *string
+	targetOrg      *string
+	targetToken    *string
+	team           *string
+	dataDir        *string
+	token          *string
+	apiURL         *string
+	targetAPIURL   *string
+	rateMin        *int
+	attempts       *int
+	workers        *int
+	engine         *string
+	sso            *string
+	pull           *bool
+	pullType       *string
+	users          *bool
+	userData       *string
+	teams          *bool
+	client         *ghapi.Client
+	// target is the client of the org users are migrated into, client itself unless -target-org is set
+	target *ghapi.Client
 )
 
-func init() {
+// parseFlags reads the flags and environment and creates the API clients.
+// It is called from main rather than init so the package can be tested.
+func parseFlags() {
 	pull = flag.Bool("pull", false, "Pull latest from API")
-	pullType = flag.String("type", "all", "Type of data to pull. [collaborators|users|memberships|teams|invitations|repositories|all].")
+	pullType = flag.String("type", "all", "Type of data to pull. [collaborators|repo-collaborators|users|memberships|teams|invitations|repositories|identities|all].")
+	engine = flag.String("engine", "rest", "API used to pull users, memberships and teams. [rest|graphql]")
 	migrate = flag.String("migrate", "", "Migrate specified user to SSO")
+	migrateTeam = flag.String("migrate-team", "", "Migrate all members of the specified team to SSO")
+	migrateFile = flag.String("migrate-file", "", "Migrate users listed one login per line in the specified file to SSO")
+	migrateAll = flag.Bool("migrate-all", false, "Migrate all users in the org to SSO")
+	migrateAdmins = flag.Bool("migrate-admins", false, "Also migrate org admins selected by -migrate-team, -migrate-file or -migrate-all. The user the token belongs to is always skipped")
+	maxFailures = flag.Int("max-failures", 0, "Users allowed to fail in a batch migration before it stops. -1 for no limit")
 	remove = flag.String("remove", "", "Remove specified user from org")
+	rollbackTo = flag.String("rollback", "", "Restore a user, the members of a team, or all users to their org role and teams before the first migration. [<user>|<team>|all]")
+	reconcileOn = flag.Bool("reconcile", false, "Add migrated users who have accepted their invitation back to any teams they are missing from")
+	reconcileFile = flag.String("reconcile-file", "", "Reconcile the users listed one login per line in the specified file instead of all migrated users")
+	outside = flag.String("outside", "", "Migrate outside collaborators in repo_collaborators.json. [readd|convert]. readd re-adds them to their repos, convert also invites them as org members")
+	outsideUsers = flag.String("outside-users", "", "Comma separated outside collaborators to migrate with -outside. Default all, required for convert")
+	replicate = flag.Bool("replicate-teams", false, "Create the teams in teams.json, with their nesting, privacy and description, in the target org. Teams that already exist are skipped")
+	teamRepos = flag.Bool("apply-team-repos", false, "Grant each team in teams.json its pulled permission on its repositories in the target org, reporting missing repos")
+	transfer = flag.Bool("transfer", false, "Transfer the repos selected with -repos, -repo-topic, -repo-team and -repo-language to the target org, re-attaching their teams. Outcomes are recorded in transfers.json")
+	transferRename = flag.Bool("transfer-rename", false, "Transfer a repo whose name is taken in the target org as <name>-<source org>")
+	backupDir = flag.String("backup-repos", "", "Mirror the org's repos and their wikis, or the repos selected with -repos, -repo-topic, -repo-team and -repo-language, into the specified directory, recording the commit of each in manifest.json")
+	stateAction = flag.String("state", "", "Diff the desired org members, teams and team repo permissions in -state-file against a fresh pull. [plan|apply]. plan prints the changes, apply makes them")
+	stateFile = flag.String("state-file", "", "JSON file describing the desired state of the org for -state")
+	skipArchived = flag.Bool("skip-archived", false, "Skip archived repos with -backup-repos")
+	repoNames = flag.String("repos", "", "Comma separated names of repos to select")
+	repoTopic = flag.String("repo-topic", "", "Select repos tagged with the specified topic")
+	repoTeam = flag.String("repo-team", "", "Select repos the specified team has access to")
+	repoLanguage = flag.String("repo-language", "", "Select repos whose primary language is the specified language")
+	invites = flag.String("invitations", "", "Follow up on the invitations of migrated users. [report|resend|cancel]. resend re-invites users whose invitation expired, cancel cancels invitations pending longer than -stale-days")
+	staleDays = flag.Int("stale-days", 14, "Days after which -invitations cancel treats a pending invitation as stale")
+	dryRun = flag.Bool("dry-run", false, "Print the changes -migrate, -remove, -invitations, -reconcile, -outside, -replicate-teams, -apply-team-repos, -transfer, -backup-repos or -state would make without making them")
+	planFile = flag.String("plan-file", "", "Also write the -dry-run plan as JSON to the specified file")
 	dataDir = flag.String("dir", "", "Directory to store local data. Can be overridden with DATA_DIR env var")
 	token = flag.String("token", "", "GitHub token. Can be overridden with GITHUB_TOKEN env var")
+	apiURL = flag.String("api-url", ghapi.DefaultBaseURL, "GitHub API base URL, e.g. https://ghe.example.com/api/v3. Can be overridden with GITHUB_API_URL env var")
+	rateMin = flag.Int("rate-limit-min", ghapi.DefaultRateLimitLowWater, "Remaining API requests at which to pause until the rate limit resets")
+	attempts = flag.Int("max-attempts", ghapi.DefaultRetryPolicy.MaxAttempts, "Maximum attempts for an API request failing with a transient error")
+	workers = flag.Int("concurrency", 1, "Number of users or teams to pull, or repos to back up, in parallel")
 	org = flag.String("org", "", "Organization to migrate. Can be overridden with GITHUB_ORG env var")
+	flag.StringVar(org, "source-org", "", "Organization to migrate users from when migrating to -target-org. Same as -org")
+	targetOrg = flag.String("target-org", "", "Organization to migrate users into. Default the source org. Can be overridden with TARGET_GITHUB_ORG env var")
+	targetAPIURL = flag.String("target-api-url", "", "GitHub API base URL of the target org, e.g. to migrate from GitHub Enterprise Server to github.com. Default -api-url. Can be overridden with TARGET_GITHUB_API_URL env var")
+	targetToken = flag.String("target-token", "", "GitHub token for the target org. Default the source token. Can be overridden with TARGET_GITHUB_TOKEN env var")
 	team = flag.String("team", "", "Team to operate against. Default to operate against all users")
 	users = flag.Bool("users", false, "Print list of users to STDOUT")
-	userData = flag.String("data", "login", "Print specific data for a user")
+	userData = flag.String("data", "login", "Print specific data for a user. SSO identity fields (name_id, upn) are read from sso_identities.json")
+	sso = flag.String("sso", "", "Only print users whose SSO identity is [linked|unlinked]. Requires -pull -type identities")
 	teams = flag.Bool("teams", false, "Print list of teams to STDOUT")
 	flag.Parse()
 	if os.Getenv("GITHUB_TOKEN") != "" {
@@ -45,15 +125,63 @@ func init() {
 	if os.Getenv("GITHUB_ORG") != "" {
 		*org = os.Getenv("GITHUB_ORG")
 	}
-	ghapi.Org = *org
-	ghapi.DataDir = *dataDir
-	ghapi.Token = *token
+	if os.Getenv("GITHUB_API_URL") != "" {
+		*apiURL = os.Getenv("GITHUB_API_URL")
+	}
+	if os.Getenv("TARGET_GITHUB_ORG") != "" {
+		*targetOrg = os.Getenv("TARGET_GITHUB_ORG")
+	}
+	if os.Getenv("TARGET_GITHUB_TOKEN") != "" {
+		*targetToken = os.Getenv("TARGET_GITHUB_TOKEN")
+	}
+	if os.Getenv("TARGET_GITHUB_API_URL") != "" {
+		*targetAPIURL = os.Getenv("TARGET_GITHUB_API_URL")
+	}
 	if *org == "" {
 		log.Fatal("org required")
 	}
 	if *token == "" {
 		log.Fatal("token required")
 	}
+	if *engine != "rest" && *engine != "graphql" {
+		log.Fatal("engine must be rest or graphql")
+	}
+	if *sso != "" && *sso != "linked" && *sso != "unlinked" {
+		log.Fatal("sso must be linked or unlinked")
+	}
+	if *stateAction != "" && *stateAction != "plan" && *stateAction != "apply" {
+		log.Fatal("state must be plan or apply")
+	}
+	if *stateAction != "" && *stateFile == "" {
+		log.Fatal("state-file required with state")
+	}
+	if *stateAction == "plan" {
+		*dryRun = true
+	}
+	if *planFile != "" && !*dryRun {
+		log.Fatal("plan-file requires dry-run")
+	}
+	if *invites != "" && *invites != "report" && *invites != "resend" && *invites != "cancel" {
+		log.Fatal("invitations must be report, resend or cancel")
+	}
+	if *outside != "" && *outside != "readd" && *outside != "convert" {
+		log.Fatal("outside must be readd or convert")
+	}
+	if *rollbackTo != "" && *pull {
+		log.Fatal("rollback restores from the previously pulled data, it cannot be combined with pull")
+	}
+	if *rollbackTo != "" && *dryRun {
+		log.Fatal("dry-run is not supported with rollback")
+	}
+	var batches int
+	for _, b := range []bool{*migrateTeam != "", *migrateFile != "", *migrateAll} {
+		if b {
+			batches++
+		}
+	}
+	if batches > 1 {
+		log.Fatal("only one of migrate-team, migrate-file and migrate-all may be set")
+	}
 	if *dataDir == "" {
 		log.Fatal("data required")
 	} else if _, err := os.Stat(*dataDir); os.IsNotExist(err) {
@@ -62,44 +190,186 @@ func init() {
 			log.Fatal(derr)
 		}
 	}
+	client = newClient(*org, *token, *apiURL)
+	target = client
+	if *targetOrg == "" {
+		*targetOrg = *org
+	}
+	if *targetAPIURL == "" {
+		*targetAPIURL = *apiURL
+	}
+	if !strings.EqualFold(*targetOrg, *org) || *targetAPIURL != *apiURL {
+		if *targetToken == "" {
+			*targetToken = *token
+		}
+		target = newClient(*targetOrg, *targetToken, *targetAPIURL)
+		if *targetToken == *token && *targetAPIURL == *apiURL {
+			// Both orgs draw on the same rate limit budget
+			target.RateLimiter = client.RateLimiter
+		}
+	}
 }
 
-func pullAll() {
-	pullUsers()
-	pullMembership()
-	pullTeams()
+// newClient creates a client for org on the API at apiURL configured from the flags
+func newClient(org, token, apiURL string) *ghapi.Client {
+	c := ghapi.NewClient(org, token, *dataDir)
+	c.BaseURL = apiURL
+	c.RateLimiter.LowWater = *rateMin
+	c.Retry.MaxAttempts = *attempts
+	c.Concurrency = *workers
+	// Guard against any state change slipping through a dry run
+	c.ReadOnly = *dryRun
+	return c
 }
 
-func pullData() {
+// sameOrg reports whether users are migrated within the source org
+func sameOrg() bool {
+	return target == client
+}
+
+// loadSnapshot loads the pulled data once for both the source and target clients
+func loadSnapshot() (*ghapi.Snapshot, error) {
+	s, err := client.LoadSnapshot()
+	if err != nil || sameOrg() {
+		return s, err
+	}
+	_, err = target.LoadSnapshot()
+	return s, err
+}
+
+func pullAll(ctx context.Context) {
+	if *engine == "graphql" {
+		pullGraphQL(ctx, true, true, true)
+		pullRepoCollaborators(ctx)
+		return
+	}
+	pullUsers(ctx)
+	pullMembership(ctx)
+	pullTeams(ctx)
+	pullRepoCollaborators(ctx)
+}
+
+func pullData(ctx context.Context) {
 	switch *pullType {
 	case "all":
-		pullAll()
+		pullAll(ctx)
 	case "collaborators":
-		pullOutsideCollaborators()
+		pullOutsideCollaborators(ctx)
+	case "repo-collaborators":
+		pullRepoCollaborators(ctx)
 	case "users":
-		pullUsers()
+		if *engine == "graphql" {
+			pullGraphQL(ctx, true, false, false)
+		} else {
+			pullUsers(ctx)
+		}
 	case "memberships":
-		pullMembership()
+		if *engine == "graphql" {
+			pullGraphQL(ctx, false, true, false)
+		} else {
+			pullMembership(ctx)
+		}
 	case "teams":
-		pullTeams()
+		if *engine == "graphql" {
+			pullGraphQL(ctx, false, false, true)
+		} else {
+			pullTeams(ctx)
+		}
 	case "invitations":
-		pullInvitations()
+		pullInvitations(ctx)
 	case "repositories":
-		pullRepositories()
+		pullRepositories(ctx)
+	case "identities":
+		pullIdentities(ctx)
 	}
 }
 
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM.
+// In-flight API calls stop and nothing partially pulled is saved.
+// A second signal terminates the process immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-sigs:
+			log.Printf("Received %s, stopping\n", s)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
+
 func main() {
+	parseFlags()
+	ctx, cancel := signalContext()
+	defer cancel()
 	if *pull {
-		pullData()
-	} else {
-		checkAndPull()
+		pullData(ctx)
+	} else if *stateAction == "" {
+		// -state pulls afresh itself
+		checkAndPull(ctx)
+	}
+	if *stateAction != "" {
+		err := applyState(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *backupDir != "" {
+		err := backupRepos(ctx, *backupDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *replicate {
+		err := replicateTeams(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *transfer {
+		err := transferRepos(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *teamRepos {
+		err := applyTeamRepos(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !sameOrg() && (*migrate != "" || *migrateTeam != "" || *migrateFile != "" || *migrateAll || *invites != "" || *outside != "") {
+		// Invitations name teams by ID, which differ between orgs
+		if merr := target.MapTeamsContext(ctx); merr != nil {
+			log.Fatal(merr)
+		}
+	}
+	if !*dryRun && (*migrate != "" || *migrateTeam != "" || *migrateFile != "" || *migrateAll) {
+		// Rollback restores users from the data as it was before the first migration
+		if serr := client.SavePreMigrationSnapshot(); serr != nil {
+			log.Fatal(serr)
+		}
 	}
 	if *migrate != "" {
+		lg, lerr := client.LoadLedger()
+		if lerr != nil {
+			log.Fatal(lerr)
+		}
 		u := ghapi.User{
 			Login: *migrate,
 		}
-		err := migrateUser(u)
+		err := migrateUser(ctx, lg, u)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *migrateTeam != "" || *migrateFile != "" || *migrateAll {
+		err := migrateBatch(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -108,11 +378,43 @@ func main() {
 		u := ghapi.User{
 			Login: *remove,
 		}
-		err := removeUser(u)
+		err := removeUser(ctx, u)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *rollbackTo != "" {
+		err := rollback(ctx, *rollbackTo)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
+	if *reconcileOn || *reconcileFile != "" {
+		err := reconcile(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *outside != "" {
+		err := migrateOutsideCollaborators(ctx, *outside)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *invites != "" {
+		err := invitations(ctx, *invites)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *dryRun {
+		printPlan()
+		if *planFile != "" {
+			if werr := writePlan(*planFile); werr != nil {
+				log.Fatal(werr)
+			}
+		}
+	}
 	if *teams {
 		perr := printTeams()
 		if perr != nil {
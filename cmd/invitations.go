@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// invitationStatus is the state of a migrated user's org invitation
+type invitationStatus struct {
+	Login  string
+	Status string
+	// Since is when the user was invited, from the ledger or else the invitation
+	Since      time.Time
+	Invitation *ghapi.Invitation
+}
+
+// pending returns how long the user has been waiting to accept, or zero if unknown
+func (s *invitationStatus) pending(now time.Time) time.Duration {
+	if s.Since.IsZero() {
+		return 0
+	}
+	return now.Sub(s.Since)
+}
+
+// formatAge formats d in days and hours
+func formatAge(d time.Duration) string {
+	h := int(d.Hours())
+	return fmt.Sprintf("%dd%dh", h/24, h%24)
+}
+
+// invitationStatuses correlates the migrated users with the org's pending and
+// failed invitations. Users recorded as having accepted are active. Others without
+// a pending invitation are looked up to tell whether they have accepted since, before
+// their latest failed invitation is considered. Failures from before the user was
+// last invited are ignored, as they were followed by a new invitation.
+func invitationStatuses(ctx context.Context, lg *ghapi.Ledger) ([]*invitationStatus, error) {
+	ls, lerr := client.MigratedLogins(lg)
+	if lerr != nil {
+		return nil, lerr
+	}
+	pis, perr := target.GetAllInvitationsContext(ctx)
+	if perr != nil {
+		return nil, perr
+	}
+	fis, ferr := target.GetFailedInvitationsContext(ctx)
+	if ferr != nil {
+		return nil, ferr
+	}
+	pending := make(map[string]*ghapi.Invitation)
+	for _, i := range pis {
+		pending[strings.ToLower(i.Login)] = i
+	}
+	failed := make(map[string]*ghapi.Invitation)
+	for _, i := range fis {
+		k := strings.ToLower(i.Login)
+		// Keep the most recent failure, timestamps are RFC 3339 so compare as strings
+		if f, ok := failed[k]; !ok || i.FailedAt > f.FailedAt {
+			failed[k] = i
+		}
+	}
+	var ss []*invitationStatus
+	for _, l := range ls {
+		s := &invitationStatus{
+			Login: l,
+		}
+		r := lg.Record(l)
+		if sr, ok := r.Steps[ghapi.StepInvited]; ok && sr.Done {
+			s.Since = sr.At
+		}
+		k := strings.ToLower(l)
+		if i, ok := pending[k]; ok {
+			s.Status = "pending"
+			s.Invitation = i
+			if s.Since.IsZero() {
+				s.Since, _ = time.Parse(time.RFC3339, i.CreatedAt)
+			}
+			ss = append(ss, s)
+			continue
+		}
+		if r.StepDone(ghapi.StepAccepted) {
+			s.Status = "active"
+			ss = append(ss, s)
+			continue
+		}
+		m, merr := target.GetUserMembershipContext(ctx, &ghapi.User{Login: l})
+		if merr != nil && !ghapi.IsNotFound(merr) {
+			return ss, merr
+		}
+		i, ok := failed[k]
+		if ok && !s.Since.IsZero() {
+			if ft, terr := time.Parse(time.RFC3339, i.FailedAt); terr == nil && ft.Before(s.Since) {
+				ok = false
+			}
+		}
+		if merr == nil {
+			s.Status = m.State
+		} else if ok && i.Expired() {
+			s.Status = "expired"
+			s.Invitation = i
+		} else if ok {
+			s.Status = "failed"
+			s.Invitation = i
+		} else {
+			s.Status = "not_invited"
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// invitations runs the -invitations command: report, resend or cancel
+func invitations(ctx context.Context, cmd string) error {
+	lg, lerr := client.LoadLedger()
+	if lerr != nil {
+		return lerr
+	}
+	ss, serr := invitationStatuses(ctx, lg)
+	if serr != nil {
+		return serr
+	}
+	now := time.Now()
+	switch cmd {
+	case "report":
+		for _, s := range ss {
+			var detail string
+			switch s.Status {
+			case "pending":
+				detail = "since " + s.Since.Format(time.RFC3339)
+				if d := s.pending(now); d > 0 {
+					detail = "for " + formatAge(d) + " " + detail
+				}
+			case "expired", "failed":
+				detail = s.Invitation.FailedAt + " " + s.Invitation.FailedReason
+			}
+			fmt.Printf("%-24s %-12s %s\n", s.Login, s.Status, detail)
+		}
+	case "resend":
+		for _, s := range ss {
+			if s.Status != "expired" {
+				continue
+			}
+			if err := resendInvitation(ctx, lg, s); err != nil {
+				return err
+			}
+		}
+	case "cancel":
+		stale := time.Duration(*staleDays) * 24 * time.Hour
+		for _, s := range ss {
+			if s.Status != "pending" || s.pending(now) < stale {
+				continue
+			}
+			if err := cancelInvitation(ctx, lg, s); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("invitations must be report, resend or cancel")
+	}
+	return nil
+}
+
+// resendInvitation invites a user whose invitation expired again
+func resendInvitation(ctx context.Context, lg *ghapi.Ledger, s *invitationStatus) error {
+	u := ghapi.User{
+		Login: s.Login,
+	}
+	m, err := client.GetLocalMembership(&u)
+	if err != nil {
+		return err
+	}
+	if m.URL == "" {
+		err := client.GetUserDetailsContext(ctx, &u)
+		if err != nil {
+			return err
+		}
+		m.User = u
+	}
+	if *dryRun {
+		ir, ierr := target.NewInvitationRequest(m)
+		if ierr != nil {
+			return ierr
+		}
+		plan = append(plan, &planStep{
+			User:      s.Login,
+			Action:    "resend_invitation",
+			Role:      ir.Role,
+			InviteeID: ir.InviteeID,
+			Email:     ir.Email,
+			TeamIDs:   ir.TeamIDs,
+		})
+		return nil
+	}
+	ierr := target.InviteMemberContext(ctx, m)
+	if ierr != nil {
+		return lg.Fail(s.Login, ghapi.StepInvited, ierr)
+	}
+	return lg.Complete(s.Login, ghapi.StepInvited)
+}
+
+// cancelInvitation cancels a stale pending invitation. The ledger records the
+// invitation step as failed, so migrating the user again re-invites them.
+func cancelInvitation(ctx context.Context, lg *ghapi.Ledger, s *invitationStatus) error {
+	if *dryRun {
+		plan = append(plan, &planStep{
+			User:   s.Login,
+			Action: "cancel_invitation",
+		})
+		return nil
+	}
+	if err := target.CancelInvitationContext(ctx, s.Invitation); err != nil {
+		return err
+	}
+	cerr := errors.New("invitation cancelled after pending " + formatAge(s.pending(time.Now())))
+	if ferr := lg.Fail(s.Login, ghapi.StepInvited, cerr); ferr != cerr {
+		return ferr
+	}
+	log.Printf("Cancelled stale invitation for: %s\n", s.Login)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+func TestInvitationStatuses(t *testing.T) {
+	now := time.Now().UTC()
+	before := now.Add(-48 * time.Hour).Format(time.RFC3339)
+	after := now.Add(time.Hour).Format(time.RFC3339)
+	pending := []*ghapi.Invitation{
+		{ID: 1, Login: "pat", CreatedAt: before},
+	}
+	failed := []*ghapi.Invitation{
+		// acc accepted a later invitation, which the ledger records
+		{ID: 2, Login: "acc", FailedAt: before, FailedReason: "Invitation expired"},
+		// res was invited again outside the tool and accepted
+		{ID: 3, Login: "res", FailedAt: after, FailedReason: "Invitation expired"},
+		{ID: 4, Login: "exp", FailedAt: after, FailedReason: "Invitation expired"},
+		{ID: 5, Login: "dec", FailedAt: after, FailedReason: "Invitation declined"},
+		// old was invited again after this failure, and that invitation was then cancelled
+		{ID: 6, Login: "old", FailedAt: before, FailedReason: "Invitation expired"},
+	}
+	states := map[string]string{"res": "active"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		switch {
+		case r.URL.Path == "/orgs/o/invitations":
+			v = pending
+		case r.URL.Path == "/orgs/o/failed_invitations":
+			v = failed
+		case strings.HasPrefix(r.URL.Path, "/orgs/o/memberships/"):
+			login := strings.TrimPrefix(r.URL.Path, "/orgs/o/memberships/")
+			if login == "acc" {
+				t.Errorf("looked up the membership of acc, who the ledger records as accepted")
+			}
+			st, ok := states[login]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message":"Not Found"}`)
+				return
+			}
+			v = map[string]string{"state": st, "role": "member"}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	}))
+	defer srv.Close()
+	dir, derr := ioutil.TempDir("", "invitations")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	client = ghapi.NewClient("o", "t", dir)
+	client.BaseURL = srv.URL
+	client.Transport = srv.Client().Transport
+	target = client
+	lg, lerr := client.LoadLedger()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	for _, l := range []string{"pat", "acc", "res", "exp", "dec", "old", "nobody"} {
+		if err := lg.Complete(l, ghapi.StepInvited); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lg.Complete("acc", ghapi.StepAccepted); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := invitationStatuses(context.Background(), lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"pat":    "pending",
+		"acc":    "active",
+		"res":    "active",
+		"exp":    "expired",
+		"dec":    "failed",
+		"old":    "not_invited",
+		"nobody": "not_invited",
+	}
+	if len(ss) != len(want) {
+		t.Errorf("got %d statuses, want %d", len(ss), len(want))
+	}
+	for _, s := range ss {
+		if s.Status != want[s.Login] {
+			t.Errorf("%s status = %s, want %s", s.Login, s.Status, want[s.Login])
+		}
+	}
+}
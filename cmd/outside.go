@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// selectedOutsideCollaborators returns the repo access of the outside collaborators
+// in repo_collaborators.json, limited to -outside-users if set
+func selectedOutsideCollaborators() ([]*ghapi.RepoCollaborator, error) {
+	orcs, err := client.OutsideRepoCollaborators()
+	if os.IsNotExist(err) {
+		return nil, errors.New("no repo collaborators pulled, run -pull -type repo-collaborators first")
+	} else if err != nil {
+		return nil, err
+	}
+	if *outsideUsers == "" {
+		return orcs, nil
+	}
+	sel := make(map[string]bool)
+	for _, l := range strings.Split(*outsideUsers, ",") {
+		sel[strings.ToLower(strings.TrimSpace(l))] = true
+	}
+	var srcs []*ghapi.RepoCollaborator
+	for _, rc := range orcs {
+		if sel[strings.ToLower(rc.Login)] {
+			srcs = append(srcs, rc)
+		}
+	}
+	return srcs, nil
+}
+
+// migrateOutsideCollaborators re-adds outside collaborators to their repos with
+// their pulled permission, first inviting them to the org as members in convert mode
+func migrateOutsideCollaborators(ctx context.Context, mode string) error {
+	if mode == "convert" && *outsideUsers == "" {
+		return errors.New("outside-users required to convert outside collaborators to members")
+	}
+	rcs, err := selectedOutsideCollaborators()
+	if err != nil {
+		return err
+	}
+	var logins []string
+	byLogin := make(map[string][]*ghapi.RepoCollaborator)
+	for _, rc := range rcs {
+		k := strings.ToLower(rc.Login)
+		if _, ok := byLogin[k]; !ok {
+			logins = append(logins, rc.Login)
+		}
+		byLogin[k] = append(byLogin[k], rc)
+	}
+	log.Printf("Migrating %d outside collaborators\n", len(logins))
+	var failed int
+	for i, l := range logins {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[%d/%d] Migrating outside collaborator: %s\n", i+1, len(logins), l)
+		if merr := migrateOutsideCollaborator(ctx, mode, byLogin[strings.ToLower(l)]); merr != nil {
+			failed++
+			fmt.Printf("%s: failed: %v\n", l, merr)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d outside collaborators failed to migrate", failed, len(logins))
+	}
+	return nil
+}
+
+// migrateOutsideCollaborator migrates a single outside collaborator, given their repo access
+func migrateOutsideCollaborator(ctx context.Context, mode string, rcs []*ghapi.RepoCollaborator) error {
+	u := ghapi.User{
+		Login: rcs[0].Login,
+		ID:    rcs[0].ID,
+	}
+	if mode == "convert" {
+		m := &ghapi.Membership{
+			Role: "member",
+			User: u,
+		}
+		if *dryRun {
+			ir, ierr := target.NewInvitationRequest(m)
+			if ierr != nil {
+				return ierr
+			}
+			plan = append(plan, &planStep{
+				User:      u.Login,
+				Action:    "invite",
+				Role:      ir.Role,
+				InviteeID: ir.InviteeID,
+			})
+		} else if ierr := target.InviteMemberContext(ctx, m); ierr != nil {
+			return ierr
+		}
+	}
+	for _, rc := range rcs {
+		if *dryRun {
+			plan = append(plan, &planStep{
+				User:       u.Login,
+				Action:     "grant_repo",
+				Role:       rc.Permission,
+				Repository: rc.Repository,
+			})
+			continue
+		}
+		aerr := target.AddRepoCollaboratorContext(ctx, rc)
+		if ghapi.IsNotFound(aerr) {
+			log.Printf("Repo %s not found, skipping\n", rc.Repository)
+		} else if aerr != nil {
+			return aerr
+		}
+	}
+	return nil
+}
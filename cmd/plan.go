@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// planStep is a change -migrate or -remove would make, recorded by -dry-run
+type planStep struct {
+	User       string   `json:"user"`
+	Action     string   `json:"action"`
+	Role       string   `json:"role,omitempty"`
+	InviteeID  int      `json:"invitee_id,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	TeamIDs    []int    `json:"team_ids,omitempty"`
+	Teams      []string `json:"teams,omitempty"`
+	Team       string   `json:"team,omitempty"`
+	Repository string   `json:"repository,omitempty"`
+	NewName    string   `json:"new_name,omitempty"`
+	Privacy    string   `json:"privacy,omitempty"`
+	Parent     string   `json:"parent,omitempty"`
+}
+
+// plan holds the steps recorded by a dry run, in order
+var plan []*planStep
+
+// planMigrateUser records the steps migrateUser would take for u. Steps already
+// completed in the ledger are left out, as a real run would skip them.
+func planMigrateUser(ctx context.Context, lg *ghapi.Ledger, u ghapi.User) error {
+	rec := lg.Record(u.Login)
+	if rec.Done() {
+		log.Printf("User %s already migrated\n", u.Login)
+		return nil
+	}
+	m, err := client.GetLocalMembership(&u)
+	if err != nil {
+		return err
+	}
+	if m.URL == "" {
+		err := client.GetUserDetailsContext(ctx, &u)
+		if err != nil {
+			return err
+		}
+		m.User = u
+	}
+	if !rec.StepDone(ghapi.StepRemoved) && m.URL != "" && sameOrg() {
+		plan = append(plan, &planStep{
+			User:   u.Login,
+			Action: "remove",
+			Role:   m.Role,
+		})
+	}
+	if !rec.StepDone(ghapi.StepInvited) {
+		ir, ierr := target.NewInvitationRequest(m)
+		if ierr != nil {
+			return ierr
+		}
+		plan = append(plan, &planStep{
+			User:      u.Login,
+			Action:    "invite",
+			Role:      ir.Role,
+			InviteeID: ir.InviteeID,
+			Email:     ir.Email,
+			TeamIDs:   ir.TeamIDs,
+		})
+	}
+	if !rec.StepDone(ghapi.StepAccepted) {
+		plan = append(plan, &planStep{
+			User:   u.Login,
+			Action: "await_acceptance",
+		})
+	}
+	if !rec.StepDone(ghapi.StepTeamsRestored) {
+		ts, terr := client.UserTeams(&m.User)
+		if terr != nil {
+			return terr
+		}
+		for _, t := range ts {
+			plan = append(plan, &planStep{
+				User:   u.Login,
+				Action: "add_to_team",
+				Role:   t.MemberRole(&m.User),
+				Team:   t.Slug,
+			})
+		}
+	}
+	if !rec.StepDone(ghapi.StepReposRestored) {
+		rcs, rerr := client.UserRepoCollaborators(&m.User)
+		if rerr != nil && !os.IsNotExist(rerr) {
+			return rerr
+		}
+		for _, rc := range rcs {
+			plan = append(plan, &planStep{
+				User:       u.Login,
+				Action:     "grant_repo",
+				Role:       rc.Permission,
+				Repository: rc.Repository,
+			})
+		}
+	}
+	return nil
+}
+
+// planRemoveUser records the steps removeUser would take for u
+func planRemoveUser(u ghapi.User) error {
+	m, err := client.GetLocalMembership(&u)
+	if err != nil {
+		return err
+	}
+	if m.URL == "" {
+		log.Printf("User %s is not a member in the local data, nothing to remove\n", u.Login)
+		return nil
+	}
+	plan = append(plan, &planStep{
+		User:   u.Login,
+		Action: "remove",
+		Role:   m.Role,
+	})
+	return nil
+}
+
+// printPlan prints the dry-run plan, one step per line
+func printPlan() {
+	printSteps(plan)
+}
+
+// printSteps prints steps one per line, or that there are no changes
+func printSteps(steps []*planStep) {
+	if len(steps) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+	for _, s := range steps {
+		var ds []string
+		if s.Role != "" {
+			ds = append(ds, "role: "+s.Role)
+		}
+		if s.InviteeID != 0 {
+			ds = append(ds, fmt.Sprintf("invitee_id: %d", s.InviteeID))
+		}
+		if s.Email != "" {
+			ds = append(ds, "email: "+s.Email)
+		}
+		if len(s.TeamIDs) > 0 {
+			ds = append(ds, fmt.Sprintf("team_ids: %v", s.TeamIDs))
+		}
+		if len(s.Teams) > 0 {
+			ds = append(ds, fmt.Sprintf("teams: %v", s.Teams))
+		}
+		if s.Team != "" && s.User != "" {
+			ds = append(ds, "team: "+s.Team)
+		}
+		if s.Repository != "" {
+			ds = append(ds, "repository: "+s.Repository)
+		}
+		if s.NewName != "" {
+			ds = append(ds, "new name: "+s.NewName)
+		}
+		if s.Privacy != "" {
+			ds = append(ds, "privacy: "+s.Privacy)
+		}
+		if s.Parent != "" {
+			ds = append(ds, "parent: "+s.Parent)
+		}
+		subject := s.User
+		if subject == "" && s.Team != "" {
+			subject = s.Team
+		} else if subject == "" && s.Repository != "" {
+			subject = s.Repository
+		} else if subject == "" {
+			subject = s.Email
+		}
+		line := fmt.Sprintf("%-16s %s", s.Action, subject)
+		if len(ds) > 0 {
+			line += " (" + strings.Join(ds, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// writePlan writes the dry-run plan as JSON to f
+func writePlan(f string) error {
+	jd, jerr := json.MarshalIndent(plan, "", "  ")
+	if jerr != nil {
+		return jerr
+	}
+	log.Printf("Saving plan to: %s\n", f)
+	return ioutil.WriteFile(f, jd, 0644)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// reconcileUser adds an active member back to any team in teams.json they are
+// missing from, or hold a lesser role in. It returns the teams changed, and
+// false if the user has not yet accepted their invitation.
+func reconcileUser(ctx context.Context, lg *ghapi.Ledger, u ghapi.User) ([]string, bool, error) {
+	var changed []string
+	um, merr := target.GetUserMembershipContext(ctx, &u)
+	if merr != nil && !ghapi.IsNotFound(merr) {
+		return changed, false, merr
+	}
+	if um.State != "active" {
+		return changed, false, nil
+	}
+	ts, terr := client.UserTeams(&u)
+	if terr != nil {
+		return changed, true, terr
+	}
+	m := &ghapi.Membership{
+		User: u,
+	}
+	for _, t := range ts {
+		role := t.MemberRole(&u)
+		tm, gerr := target.GetTeamMembershipContext(ctx, t, &u)
+		if gerr != nil && !ghapi.IsNotFound(gerr) {
+			return changed, true, gerr
+		}
+		if gerr == nil && (tm.Role == role || tm.Role == "maintainer") {
+			continue
+		}
+		changed = append(changed, t.Slug+" ("+role+")")
+		if *dryRun {
+			plan = append(plan, &planStep{
+				User:   u.Login,
+				Action: "add_to_team",
+				Role:   role,
+				Team:   t.Slug,
+			})
+			continue
+		}
+		if ierr := target.InviteMemberToTeamContext(ctx, m, t); ierr != nil {
+			return changed, true, ierr
+		}
+	}
+	if *dryRun {
+		return changed, true, nil
+	}
+	if lerr := lg.Complete(u.Login, ghapi.StepAccepted); lerr != nil {
+		return changed, true, lerr
+	}
+	return changed, true, lg.Complete(u.Login, ghapi.StepTeamsRestored)
+}
+
+// reconcile restores the missing team memberships of every migrated user who
+// has accepted their invitation, or of the users listed in -reconcile-file
+func reconcile(ctx context.Context) error {
+	if _, serr := loadSnapshot(); serr != nil {
+		return serr
+	}
+	lg, lerr := client.LoadLedger()
+	if lerr != nil {
+		return lerr
+	}
+	var ls []string
+	var err error
+	if *reconcileFile != "" {
+		ls, err = readLoginFile(*reconcileFile)
+	} else {
+		ls, err = client.MigratedLogins(lg)
+	}
+	if err != nil {
+		return err
+	}
+	var reconciled, inactive, failed int
+	for i, l := range ls {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[%d/%d] Reconciling teams for user: %s\n", i+1, len(ls), l)
+		changed, active, rerr := reconcileUser(ctx, lg, ghapi.User{Login: l})
+		switch {
+		case rerr != nil:
+			failed++
+			fmt.Printf("%s: failed: %v\n", l, rerr)
+		case !active:
+			inactive++
+			fmt.Printf("%s: not yet an active member\n", l)
+		default:
+			reconciled++
+			for _, t := range changed {
+				fmt.Printf("%s: added to %s\n", l, t)
+			}
+		}
+	}
+	fmt.Printf("Reconciled: %d, not yet active: %d, failed: %d\n", reconciled, inactive, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users could not be reconciled", failed, len(ls))
+	}
+	return nil
+}
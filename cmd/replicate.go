@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// replicateTeams creates every team in teams.json in the target org, parents
+// before their children. Teams already in the target org are matched by slug
+// and left as they are, so a partial run can be repeated.
+func replicateTeams(ctx context.Context) error {
+	ts, terr := client.LoadTeams()
+	if terr != nil {
+		return terr
+	}
+	ets, eerr := target.AllTeamsContext(ctx)
+	if eerr != nil {
+		return eerr
+	}
+	ids := make(map[string]int)
+	for _, t := range ets {
+		ids[t.Slug] = t.ID
+	}
+	failed := make(map[string]bool)
+	var created, existing int
+	for i, t := range ghapi.ParentFirst(ts) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, ok := ids[t.Slug]; ok {
+			existing++
+			continue
+		}
+		log.Printf("[%d/%d] Replicating team: %s\n", i+1, len(ts), t.Slug)
+		var parentID int
+		if p := t.Parent.Slug; p != "" {
+			if id, ok := ids[p]; ok {
+				parentID = id
+			} else if inTeams(ts, p) {
+				failed[t.Slug] = true
+				fmt.Printf("%s: failed: parent team %s not replicated\n", t.Slug, p)
+				continue
+			} else {
+				log.Printf("Parent team %s of %s not found in teams.json or org %s, creating %s at the top level\n", p, t.Slug, target.Org, t.Slug)
+			}
+		}
+		if *dryRun {
+			ps := &planStep{
+				Action:  "create_team",
+				Team:    t.Slug,
+				Privacy: t.Privacy,
+			}
+			if parentID != 0 {
+				ps.Parent = t.Parent.Slug
+			}
+			plan = append(plan, ps)
+			// Placeholder so that children are planned too
+			ids[t.Slug] = -1
+			created++
+			continue
+		}
+		ct, cerr := target.CreateTeamContext(ctx, t, parentID)
+		if cerr != nil {
+			failed[t.Slug] = true
+			fmt.Printf("%s: failed: %v\n", t.Slug, cerr)
+			continue
+		}
+		ids[t.Slug] = ct.ID
+		ids[ct.Slug] = ct.ID
+		created++
+	}
+	fmt.Printf("Created: %d, already present: %d, failed: %d\n", created, existing, len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d teams could not be replicated", len(failed), len(ts))
+	}
+	return nil
+}
+
+// inTeams reports whether ts contains a team with slug
+func inTeams(ts []*ghapi.Team, slug string) bool {
+	for _, t := range ts {
+		if t.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
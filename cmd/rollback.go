@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// rollbackLogins resolves the -rollback target against the pre-migration snapshot:
+// all users in memberships.json, the members of a team, or a single user
+func rollbackLogins(s *ghapi.Snapshot, target string) ([]string, error) {
+	var ls []string
+	if target == "all" {
+		for _, m := range s.Memberships {
+			ls = append(ls, m.User.Login)
+		}
+		return ls, nil
+	}
+	var isUser bool
+	for _, m := range s.Memberships {
+		if strings.EqualFold(m.User.Login, target) {
+			isUser = true
+		}
+	}
+	t := s.Team(target)
+	if t != nil && isUser {
+		return nil, errors.New(target + " is both a user and a team")
+	}
+	if t != nil {
+		for _, u := range t.Members {
+			ls = append(ls, u.Login)
+		}
+		return ls, nil
+	}
+	return []string{target}, nil
+}
+
+// rollback restores the users selected by target to their org role and team
+// memberships in the pre-migration snapshot, saving each user's result to rollback.json
+func rollback(ctx context.Context, target string) error {
+	s, serr := client.LoadPreMigrationSnapshot()
+	if serr != nil {
+		return serr
+	}
+	lg, lerr := client.LoadLedger()
+	if lerr != nil {
+		return lerr
+	}
+	ls, rerr := rollbackLogins(s, target)
+	if rerr != nil {
+		return rerr
+	}
+	var rl []*ghapi.RollbackResult
+	counts := make(map[string]int)
+	for i, l := range ls {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("[%d/%d] Rolling back user: %s\n", i+1, len(ls), l)
+		r := client.RollbackUserContext(ctx, &ghapi.User{Login: l})
+		if r.Error != "" {
+			log.Printf("[%d/%d] Rollback of %s %s: %s\n", i+1, len(ls), l, r.Status, r.Error)
+		}
+		if r.Status == ghapi.RollbackRestored || r.Status == ghapi.RollbackInvited {
+			if lerr := lg.Reset(l); lerr != nil {
+				return lerr
+			}
+		}
+		rl = append(rl, r)
+		counts[r.Status]++
+	}
+	if serr := client.SaveRollbackResults(rl); serr != nil {
+		return serr
+	}
+	fmt.Printf("Restored: %d\n", counts[ghapi.RollbackRestored])
+	fmt.Printf("Invited, roll back again once accepted to restore teams: %d\n", counts[ghapi.RollbackInvited])
+	for _, st := range []string{ghapi.RollbackFailed, ghapi.RollbackUnrestorable} {
+		fmt.Printf("%s%s: %d\n", strings.ToUpper(st[:1]), st[1:], counts[st])
+		for _, r := range rl {
+			if r.Status == st {
+				fmt.Printf("  %s: %s\n", r.Login, r.Error)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if n := counts[ghapi.RollbackFailed] + counts[ghapi.RollbackUnrestorable]; n > 0 {
+		return fmt.Errorf("%d of %d users could not be rolled back", n, len(rl))
+	}
+	return nil
+}
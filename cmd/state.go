@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// stateChange is a change that brings the org towards its desired state
+type stateChange struct {
+	step  *planStep
+	apply func(ctx context.Context) error
+}
+
+// applyState diffs the desired state in -state-file against a fresh pull of the org,
+// held in memory, and applies the changes, or only records them in the plan during a dry run
+func applyState(ctx context.Context) error {
+	ds, derr := ghapi.LoadDesiredState(*stateFile)
+	if derr != nil {
+		return derr
+	}
+	// Pulled into memory, the data files may hold the snapshot taken before a migration
+	s, serr := client.PullSnapshotContext(ctx, *engine == "graphql")
+	if serr != nil {
+		return serr
+	}
+	is, ierr := client.GetAllInvitationsContext(ctx)
+	if ierr != nil {
+		return ierr
+	}
+	cs, cerr := stateChanges(ctx, ds, s, is)
+	if cerr != nil {
+		return cerr
+	}
+	steps := make([]*planStep, len(cs))
+	for i, c := range cs {
+		steps[i] = c.step
+	}
+	if *dryRun {
+		plan = append(plan, steps...)
+		return nil
+	}
+	printSteps(steps)
+	var failed int
+	for i, c := range cs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[%d/%d] Applying %s\n", i+1, len(cs), c.step.Action)
+		if err := c.apply(ctx); err != nil {
+			failed++
+			log.Printf("Error applying %s: %s\n", c.step.Action, err)
+		}
+	}
+	fmt.Printf("Applied: %d\n", len(cs)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d changes failed, run -state plan to see what remains", failed)
+	}
+	return nil
+}
+
+// stateChanges returns the changes that bring the org from its pulled state s, with
+// pending invitations is, to the desired state ds, in the order they are to be applied:
+// teams are created, users invited, roles and team memberships changed, team repo
+// permissions changed, and finally users removed and invitations cancelled
+func stateChanges(ctx context.Context, ds *ghapi.DesiredState, s *ghapi.Snapshot, is []*ghapi.Invitation) ([]*stateChange, error) {
+	var cs []*stateChange
+	members := make(map[string]*ghapi.Membership)
+	for _, m := range s.Memberships {
+		members[strings.ToLower(m.User.Login)] = m
+	}
+	pending := make(map[string]*ghapi.Invitation)
+	for _, i := range is {
+		if i.Login != "" {
+			pending[strings.ToLower(i.Login)] = i
+		}
+	}
+	// teamIDs maps team slugs to IDs, completed as teams are created during apply
+	teamIDs := make(map[string]int)
+	for _, t := range s.Teams {
+		teamIDs[t.Slug] = t.ID
+	}
+	for _, dt := range ds.Teams {
+		if s.Team(dt.Slug) != nil {
+			continue
+		}
+		dt := dt
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				Action:  "create_team",
+				Team:    dt.Slug,
+				Privacy: dt.Privacy,
+			},
+			apply: func(ctx context.Context) error {
+				ct, err := client.CreateTeamContext(ctx, dt.Team(), 0)
+				if err != nil {
+					return err
+				}
+				if ct.Slug != dt.Slug {
+					return fmt.Errorf("team %s was created with slug %s, set its name to match", dt.Slug, ct.Slug)
+				}
+				teamIDs[ct.Slug] = ct.ID
+				return nil
+			},
+		})
+	}
+	// invited holds the users who are invited, or already have an invitation pending,
+	// and so cannot be added to teams yet
+	invited := make(map[string]bool)
+	for _, dm := range ds.Members {
+		k := strings.ToLower(dm.Login)
+		m, ok := members[k]
+		if ok {
+			if m.Role != dm.Role {
+				cs = append(cs, setRoleChange(m, dm.Role))
+			}
+			continue
+		}
+		invited[k] = true
+		if _, ok := pending[k]; ok {
+			log.Printf("Invitation already pending for %s, leaving their teams to be reconciled once accepted\n", dm.Login)
+			continue
+		}
+		ic, ierr := inviteChange(ctx, ds, dm, teamIDs)
+		if ierr != nil {
+			return cs, ierr
+		}
+		cs = append(cs, ic)
+	}
+	// inherited maps team slugs to the members they have through their child teams,
+	// whom the API lists as members of the parent team too
+	inherited := make(map[string]map[string]bool)
+	for _, t := range s.Teams {
+		if t.Parent.Slug == "" {
+			continue
+		}
+		if inherited[t.Parent.Slug] == nil {
+			inherited[t.Parent.Slug] = make(map[string]bool)
+		}
+		for _, u := range t.Members {
+			inherited[t.Parent.Slug][strings.ToLower(u.Login)] = true
+		}
+	}
+	for _, dt := range ds.Teams {
+		if dt.ManagesMembers() {
+			cs = append(cs, teamMemberChanges(ds, dt, s.Team(dt.Slug), invited, inherited[dt.Slug])...)
+		}
+	}
+	for _, dt := range ds.Teams {
+		if dt.ManagesRepos() {
+			cs = append(cs, teamRepoChanges(dt, s.Team(dt.Slug))...)
+		}
+	}
+	if !ds.ManagesMembers() {
+		return cs, nil
+	}
+	var removed []*ghapi.Membership
+	for _, m := range s.Memberships {
+		if ds.Member(m.User.Login) == nil {
+			removed = append(removed, m)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].User.Login < removed[j].User.Login
+	})
+	for _, m := range removed {
+		m := m
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				User:   m.User.Login,
+				Action: "remove",
+				Role:   m.Role,
+			},
+			apply: func(ctx context.Context) error {
+				return client.RemoveMemberContext(ctx, m)
+			},
+		})
+	}
+	for _, i := range is {
+		if i.Login != "" && ds.Member(i.Login) != nil {
+			continue
+		}
+		i := i
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				User:   i.Login,
+				Action: "cancel_invitation",
+				Email:  i.Email,
+			},
+			apply: func(ctx context.Context) error {
+				return client.CancelInvitationContext(ctx, i)
+			},
+		})
+	}
+	return cs, nil
+}
+
+// setRoleChange changes the org role of m's user to role
+func setRoleChange(m *ghapi.Membership, role string) *stateChange {
+	return &stateChange{
+		step: &planStep{
+			User:   m.User.Login,
+			Action: "set_role",
+			Role:   role,
+		},
+		apply: func(ctx context.Context) error {
+			return client.SetMemberRoleContext(ctx, &ghapi.Membership{
+				User: m.User,
+				Role: role,
+			})
+		},
+	}
+}
+
+// inviteChange invites dm to the org with their role and to every team listing them.
+// The user is looked up first, so that a login that does not exist fails the plan.
+func inviteChange(ctx context.Context, ds *ghapi.DesiredState, dm *ghapi.DesiredMember, teamIDs map[string]int) (*stateChange, error) {
+	u := ghapi.User{
+		Login: dm.Login,
+	}
+	if err := client.GetUserDetailsContext(ctx, &u); ghapi.IsNotFound(err) {
+		return nil, errors.New("user " + dm.Login + " not found")
+	} else if err != nil {
+		return nil, err
+	}
+	var teams []string
+	for _, dt := range ds.Teams {
+		if _, ok := dt.Roles()[strings.ToLower(dm.Login)]; ok {
+			teams = append(teams, dt.Slug)
+		}
+	}
+	return &stateChange{
+		step: &planStep{
+			User:      u.Login,
+			Action:    "invite",
+			Role:      dm.Role,
+			InviteeID: u.ID,
+			Teams:     teams,
+		},
+		apply: func(ctx context.Context) error {
+			m := &ghapi.Membership{
+				User: u,
+				Role: dm.Role,
+			}
+			p := &ghapi.InvitationRequest{
+				InviteeID: u.ID,
+				Role:      dm.Role,
+			}
+			if p.Role == "member" {
+				p.Role = "direct_member"
+			}
+			for _, slug := range teams {
+				if id, ok := teamIDs[slug]; ok {
+					p.TeamIDs = append(p.TeamIDs, id)
+				}
+			}
+			return client.SendInvitationContext(ctx, m, p)
+		},
+	}, nil
+}
+
+// teamMemberChanges adds, removes and changes the role of members of the team t
+// to match dt. t is nil if the team is yet to be created. Users in invited join
+// their teams with their invitation, and users removed from the org leave them.
+// Users in inherited are members through a child team, and are not removed as
+// they leave t by leaving the child team.
+func teamMemberChanges(ds *ghapi.DesiredState, dt *ghapi.DesiredTeam, t *ghapi.Team, invited, inherited map[string]bool) []*stateChange {
+	var cs []*stateChange
+	current := make(map[string]string)
+	if t != nil {
+		for _, u := range t.Members {
+			current[strings.ToLower(u.Login)] = t.MemberRole(u)
+		}
+	}
+	desired := dt.Roles()
+	tm := dt.Team()
+	for _, l := range append(append([]string{}, dt.Maintainers...), dt.Members...) {
+		k := strings.ToLower(l)
+		if invited[k] {
+			continue
+		}
+		role := desired[k]
+		cur, ok := current[k]
+		action := "add_team_member"
+		if ok && cur == role {
+			continue
+		} else if ok {
+			action = "set_team_role"
+		}
+		l := l
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				User:   l,
+				Action: action,
+				Role:   role,
+				Team:   dt.Slug,
+			},
+			apply: func(ctx context.Context) error {
+				return client.InviteMemberToTeamContext(ctx, &ghapi.Membership{User: ghapi.User{Login: l}}, tm)
+			},
+		})
+	}
+	if t == nil {
+		return cs
+	}
+	for _, u := range t.Members {
+		k := strings.ToLower(u.Login)
+		if _, ok := desired[k]; ok || inherited[k] || (ds.ManagesMembers() && ds.Member(u.Login) == nil) {
+			continue
+		}
+		u := u
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				User:   u.Login,
+				Action: "remove_team_member",
+				Role:   current[k],
+				Team:   dt.Slug,
+			},
+			apply: func(ctx context.Context) error {
+				return client.RemoveTeamMemberContext(ctx, tm, u)
+			},
+		})
+	}
+	return cs
+}
+
+// teamRepoChanges grants, changes and removes the team t's permissions on repositories
+// to match dt. t is nil if the team is yet to be created.
+func teamRepoChanges(dt *ghapi.DesiredTeam, t *ghapi.Team) []*stateChange {
+	var cs []*stateChange
+	current := make(map[string]string)
+	if t != nil {
+		for _, r := range t.Repositories {
+			current[strings.ToLower(r.Name)] = t.RepoPermission(r)
+		}
+	}
+	desired := make(map[string]bool)
+	var repos []string
+	for r := range dt.Repos {
+		desired[strings.ToLower(r)] = true
+		repos = append(repos, r)
+	}
+	sort.Strings(repos)
+	tm := dt.Team()
+	for _, r := range repos {
+		p := dt.Repos[r]
+		if cur, ok := current[strings.ToLower(r)]; ok && cur == p {
+			continue
+		}
+		r := r
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				Action:     "grant_team_repo",
+				Team:       dt.Slug,
+				Role:       p,
+				Repository: r,
+			},
+			apply: func(ctx context.Context) error {
+				return client.AddTeamRepoContext(ctx, tm, r, p)
+			},
+		})
+	}
+	if t == nil {
+		return cs
+	}
+	for _, r := range t.Repositories {
+		if desired[strings.ToLower(r.Name)] {
+			continue
+		}
+		r := r
+		cs = append(cs, &stateChange{
+			step: &planStep{
+				Action:     "revoke_team_repo",
+				Team:       dt.Slug,
+				Role:       current[strings.ToLower(r.Name)],
+				Repository: r.Name,
+			},
+			apply: func(ctx context.Context) error {
+				return client.RemoveTeamRepoContext(ctx, tm, r.Name)
+			},
+		})
+	}
+	return cs
+}
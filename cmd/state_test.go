@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// desiredState loads the desired state JSON js
+func desiredState(t *testing.T, js string) *ghapi.DesiredState {
+	dir, derr := ioutil.TempDir("", "state")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	f := path.Join(dir, "state.json")
+	if werr := ioutil.WriteFile(f, []byte(js), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	ds, err := ghapi.LoadDesiredState(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+// useTestClient points client at a server that knows the users in ids, and returns a func closing it
+func useTestClient(ids map[string]int) func() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		login := strings.TrimPrefix(r.URL.Path, "/users/")
+		id, ok := ids[login]
+		if r.Method != "GET" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Not Found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"login":%q,"id":%d}`, login, id)
+	}))
+	client = ghapi.NewClient("o", "t", "")
+	client.BaseURL = srv.URL
+	client.Transport = srv.Client().Transport
+	return srv.Close
+}
+
+// member returns an org membership of login with role
+func member(login, role string) *ghapi.Membership {
+	return &ghapi.Membership{
+		State: "active",
+		Role:  role,
+		User:  ghapi.User{Login: login},
+	}
+}
+
+// testTeam returns a team with the members and maintainers, and the repos mapped to the team's permission
+func testTeam(slug string, members, maintainers []string, repos map[string]string) *ghapi.Team {
+	t := &ghapi.Team{
+		Slug:            slug,
+		Roles:           make(map[string]string),
+		RepoPermissions: make(map[string]string),
+	}
+	for _, l := range members {
+		t.Members = append(t.Members, &ghapi.User{Login: l})
+		t.Roles[strings.ToLower(l)] = "member"
+	}
+	for _, l := range maintainers {
+		t.Members = append(t.Members, &ghapi.User{Login: l})
+		t.Roles[strings.ToLower(l)] = "maintainer"
+	}
+	for r, p := range repos {
+		t.Repositories = append(t.Repositories, &ghapi.Repository{Name: r})
+		t.RepoPermissions[r] = p
+	}
+	return t
+}
+
+// describe summarises the plan steps of cs, one "action subject role" string per change
+func describe(cs []*stateChange) []string {
+	var ds []string
+	for _, c := range cs {
+		s := c.step
+		subject := s.User
+		if subject == "" {
+			subject = s.Email
+		}
+		if s.Team != "" && s.User != "" {
+			subject += "@" + s.Team
+		} else if s.Team != "" {
+			subject = s.Team
+		}
+		if s.Repository != "" {
+			subject += "/" + s.Repository
+		}
+		ds = append(ds, strings.TrimSpace(s.Action+" "+subject+" "+s.Role))
+	}
+	return ds
+}
+
+func TestStateChanges(t *testing.T) {
+	defer useTestClient(map[string]int{"erin": 5})()
+	ds := desiredState(t, `{
+		"members": [
+			{"login": "alice", "role": "admin"},
+			{"login": "bob", "role": "admin"},
+			{"login": "dave"},
+			{"login": "erin"}
+		],
+		"teams": [
+			{"slug": "dev", "maintainers": ["alice", "bob"], "members": ["dave", "erin"], "repos": {"api": "admin", "web": "read"}},
+			{"slug": "ops", "members": ["bob"]}
+		]
+	}`)
+	s := &ghapi.Snapshot{
+		Memberships: []*ghapi.Membership{
+			member("alice", "admin"),
+			member("bob", "member"),
+			member("zed", "member"),
+			member("carol", "member"),
+		},
+		Teams: []*ghapi.Team{
+			testTeam("dev", []string{"bob"}, []string{"alice"}, map[string]string{"api": "push"}),
+		},
+	}
+	is := []*ghapi.Invitation{
+		{ID: 1, Login: "dave"},
+		{ID: 2, Email: "someone@example.com"},
+		{ID: 3, Login: "frank"},
+	}
+	cs, err := stateChanges(context.Background(), ds, s, is)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"create_team ops",
+		"set_role bob admin",
+		"invite erin member",
+		// dave's invitation is pending, so dave joins dev once they accept
+		"set_team_role bob@dev maintainer",
+		"add_team_member bob@ops member",
+		"grant_team_repo dev/api admin",
+		"grant_team_repo dev/web pull",
+		"remove carol member",
+		"remove zed member",
+		"cancel_invitation someone@example.com",
+		"cancel_invitation frank",
+	}
+	if got := describe(cs); !reflect.DeepEqual(got, want) {
+		t.Errorf("stateChanges() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if inv := cs[2].step; inv.InviteeID != 5 || !reflect.DeepEqual(inv.Teams, []string{"dev"}) {
+		t.Errorf("invite step = %+v, want invitee 5 to team dev", inv)
+	}
+}
+
+func TestStateChangesUnmanaged(t *testing.T) {
+	defer useTestClient(nil)()
+	// Without members, nobody is invited or removed, and teams are only changed where listed
+	ds := desiredState(t, `{"teams": [{"slug": "dev", "repos": {"api": "push"}}, {"slug": "ops", "members": ["bob"]}]}`)
+	s := &ghapi.Snapshot{
+		Memberships: []*ghapi.Membership{member("alice", "admin"), member("bob", "member")},
+		Teams: []*ghapi.Team{
+			testTeam("dev", []string{"bob"}, nil, map[string]string{"api": "push", "web": "pull"}),
+			testTeam("ops", []string{"alice"}, nil, nil),
+		},
+	}
+	is := []*ghapi.Invitation{{ID: 1, Email: "someone@example.com"}}
+	cs, err := stateChanges(context.Background(), ds, s, is)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"add_team_member bob@ops member",
+		"remove_team_member alice@ops member",
+		"revoke_team_repo dev/web pull",
+	}
+	if got := describe(cs); !reflect.DeepEqual(got, want) {
+		t.Errorf("stateChanges() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStateChangesUnknownUser(t *testing.T) {
+	defer useTestClient(nil)()
+	ds := desiredState(t, `{"members": [{"login": "ghost"}]}`)
+	if _, err := stateChanges(context.Background(), ds, &ghapi.Snapshot{}, nil); err == nil || !strings.Contains(err.Error(), "ghost not found") {
+		t.Errorf("stateChanges() error = %v, want user ghost not found", err)
+	}
+}
+
+func TestTeamMemberChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		team    *ghapi.Team
+		invited map[string]bool
+		// inherited lists the members the team has through a child team
+		inherited map[string]bool
+		want      []string
+	}{
+		{
+			"new team",
+			`{"teams": [{"slug": "dev", "maintainers": ["alice"], "members": ["bob"]}]}`,
+			nil, nil, nil,
+			[]string{"add_team_member alice@dev maintainer", "add_team_member bob@dev member"},
+		},
+		{
+			"unchanged",
+			`{"teams": [{"slug": "dev", "maintainers": ["Alice"], "members": ["bob"]}]}`,
+			testTeam("dev", []string{"bob"}, []string{"alice"}, nil), nil, nil,
+			nil,
+		},
+		{
+			"role changes",
+			`{"teams": [{"slug": "dev", "maintainers": ["bob"], "members": ["alice"]}]}`,
+			testTeam("dev", []string{"bob"}, []string{"alice"}, nil), nil, nil,
+			[]string{"set_team_role bob@dev maintainer", "set_team_role alice@dev member"},
+		},
+		{
+			"add and remove",
+			`{"teams": [{"slug": "dev", "members": ["alice", "carol"]}]}`,
+			testTeam("dev", []string{"alice", "bob"}, nil, nil), nil, nil,
+			[]string{"add_team_member carol@dev member", "remove_team_member bob@dev member"},
+		},
+		{
+			"invited join with their invitation",
+			`{"members": [{"login": "alice"}, {"login": "erin"}], "teams": [{"slug": "dev", "members": ["alice", "erin"]}]}`,
+			testTeam("dev", nil, nil, nil), map[string]bool{"erin": true}, nil,
+			[]string{"add_team_member alice@dev member"},
+		},
+		{
+			"users leaving the org leave their teams",
+			`{"members": [{"login": "alice"}], "teams": [{"slug": "dev", "members": ["alice"]}]}`,
+			testTeam("dev", []string{"alice", "bob"}, nil, nil), nil, nil,
+			nil,
+		},
+		{
+			"members of child teams stay",
+			`{"teams": [{"slug": "eng", "maintainers": ["carol"], "members": ["alice"]}]}`,
+			testTeam("eng", []string{"alice", "bob", "carol"}, nil, nil), nil, map[string]bool{"bob": true, "carol": true},
+			[]string{"set_team_role carol@eng maintainer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := desiredState(t, tt.state)
+			got := describe(teamMemberChanges(ds, ds.Teams[0], tt.team, tt.invited, tt.inherited))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("teamMemberChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTeamRepoChanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		repos string
+		team  *ghapi.Team
+		want  []string
+	}{
+		{"new team", `{"web": "write", "api": "read"}`, nil,
+			[]string{"grant_team_repo dev/api pull", "grant_team_repo dev/web push"}},
+		{"unchanged", `{"api": "read", "web": "maintain"}`, testTeam("dev", nil, nil, map[string]string{"api": "pull", "web": "maintain"}),
+			nil},
+		{"permission changes", `{"api": "admin"}`, testTeam("dev", nil, nil, map[string]string{"api": "pull"}),
+			[]string{"grant_team_repo dev/api admin"}},
+		{"revoke", `{}`, testTeam("dev", nil, nil, map[string]string{"api": "pull"}),
+			[]string{"revoke_team_repo dev/api pull"}},
+		{"custom role", `{"api": "security-audit"}`, testTeam("dev", nil, nil, map[string]string{"api": "security-audit"}),
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := desiredState(t, `{"teams": [{"slug": "dev", "repos": `+tt.repos+`}]}`)
+			got := describe(teamRepoChanges(ds.Teams[0], tt.team))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("teamRepoChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateChangesNestedTeams(t *testing.T) {
+	defer useTestClient(nil)()
+	// eng's members include those of its child team dev, and web, dev's child
+	ds := desiredState(t, `{
+		"members": [{"login": "alice"}, {"login": "bob"}, {"login": "carol"}],
+		"teams": [
+			{"slug": "eng", "members": ["alice"]},
+			{"slug": "dev", "members": ["bob"]},
+			{"slug": "web", "members": ["carol"]}
+		]
+	}`)
+	eng := testTeam("eng", []string{"alice", "bob", "carol"}, nil, nil)
+	dev := testTeam("dev", []string{"bob", "carol"}, nil, nil)
+	dev.Parent.Slug = "eng"
+	web := testTeam("web", []string{"carol"}, nil, nil)
+	web.Parent.Slug = "dev"
+	s := &ghapi.Snapshot{
+		Memberships: []*ghapi.Membership{member("alice", "member"), member("bob", "member"), member("carol", "member")},
+		Teams:       []*ghapi.Team{eng, dev, web},
+	}
+	cs, err := stateChanges(context.Background(), ds, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 0 {
+		t.Errorf("stateChanges() = %q, want no changes", describe(cs))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// applyTeamRepos grants every team in teams.json its pulled permission on each
+// of its repositories in the target org, reporting teams and repos missing there
+func applyTeamRepos(ctx context.Context) error {
+	ts, terr := client.LoadTeams()
+	if terr != nil {
+		return terr
+	}
+	ets, eerr := target.AllTeamsContext(ctx)
+	if eerr != nil {
+		return eerr
+	}
+	exists := make(map[string]bool)
+	for _, t := range ets {
+		exists[t.Slug] = true
+	}
+	var missingTeams, missingRepos []string
+	var granted, failed int
+	for i, t := range ts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(t.Repositories) == 0 {
+			continue
+		}
+		if !exists[t.Slug] {
+			missingTeams = append(missingTeams, t.Slug)
+			continue
+		}
+		log.Printf("[%d/%d] Granting repo permissions for team: %s\n", i+1, len(ts), t.Slug)
+		rs := make([]*ghapi.Repository, len(t.Repositories))
+		copy(rs, t.Repositories)
+		sort.Slice(rs, func(i, j int) bool {
+			return rs[i].Name < rs[j].Name
+		})
+		for _, r := range rs {
+			p := t.RepoPermission(r)
+			if *dryRun {
+				plan = append(plan, &planStep{
+					Action:     "grant_team_repo",
+					Team:       t.Slug,
+					Role:       p,
+					Repository: r.Name,
+				})
+				continue
+			}
+			aerr := target.AddTeamRepoContext(ctx, t, r.Name, p)
+			if ghapi.IsNotFound(aerr) {
+				missingRepos = append(missingRepos, fmt.Sprintf("%s (team %s: %s)", r.Name, t.Slug, p))
+			} else if aerr != nil {
+				failed++
+				fmt.Printf("%s on %s: failed: %v\n", t.Slug, r.Name, aerr)
+			} else {
+				granted++
+			}
+		}
+	}
+	if len(missingTeams) > 0 {
+		fmt.Printf("Teams missing in org %s, run -replicate-teams first:\n", target.Org)
+		for _, s := range missingTeams {
+			fmt.Printf("  %s\n", s)
+		}
+	}
+	if len(missingRepos) > 0 {
+		fmt.Printf("Repos missing in org %s:\n", target.Org)
+		for _, s := range missingRepos {
+			fmt.Printf("  %s\n", s)
+		}
+	}
+	if !*dryRun {
+		fmt.Printf("Granted: %d, missing teams: %d, missing repos: %d, failed: %d\n", granted, len(missingTeams), len(missingRepos), failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d team repo permissions could not be granted", failed)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// selectRepos returns the repos in repositories.json matching every repo filter set:
+// -repos, -repo-topic, -repo-team and -repo-language
+func selectRepos(ts []*ghapi.Team) ([]*ghapi.Repository, error) {
+	if *repoNames == "" && *repoTopic == "" && *repoTeam == "" && *repoLanguage == "" {
+		return nil, errors.New("select repos with at least one of repos, repo-topic, repo-team and repo-language")
+	}
+	rs, err := client.LoadRepositories()
+	if os.IsNotExist(err) {
+		return nil, errors.New("no repositories pulled, run -pull -type repositories first")
+	} else if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, n := range strings.Split(*repoNames, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names[strings.ToLower(n)] = true
+		}
+	}
+	teamRepos := make(map[string]bool)
+	if *repoTeam != "" {
+		var found bool
+		for _, t := range ts {
+			if t.Slug == *repoTeam {
+				found = true
+				for _, r := range t.Repositories {
+					teamRepos[strings.ToLower(r.Name)] = true
+				}
+			}
+		}
+		if !found {
+			return nil, errors.New("team " + *repoTeam + " not found in teams.json")
+		}
+	}
+	var srs []*ghapi.Repository
+	for _, r := range rs {
+		k := strings.ToLower(r.Name)
+		if len(names) > 0 && !names[k] {
+			continue
+		}
+		if *repoTeam != "" && !teamRepos[k] {
+			continue
+		}
+		if *repoLanguage != "" && !strings.EqualFold(r.Language, *repoLanguage) {
+			continue
+		}
+		if *repoTopic != "" && !hasTopic(r, *repoTopic) {
+			continue
+		}
+		srs = append(srs, r)
+	}
+	return srs, nil
+}
+
+// hasTopic reports whether r is tagged with topic
+func hasTopic(r *ghapi.Repository, topic string) bool {
+	for _, t := range r.Topics {
+		if strings.EqualFold(t, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// repoTeamAccess returns the access of each team in ts to the repo named name
+func repoTeamAccess(ts []*ghapi.Team, name string) []*ghapi.TeamAccess {
+	var tas []*ghapi.TeamAccess
+	for _, t := range ts {
+		for _, r := range t.Repositories {
+			if r.Name == name {
+				tas = append(tas, &ghapi.TeamAccess{
+					Slug:       t.Slug,
+					Permission: t.RepoPermission(r),
+				})
+				break
+			}
+		}
+	}
+	return tas
+}
+
+// transferRepos transfers the selected repos to the target org and re-attaches
+// their teams by slug. Outcomes are recorded in transfers.json, so repos that
+// are done are skipped and unfinished ones resumed when run again.
+func transferRepos(ctx context.Context) error {
+	if sameOrg() {
+		return errors.New("target-org required to transfer repos")
+	}
+	ts, terr := client.LoadTeams()
+	if terr != nil {
+		return terr
+	}
+	rs, serr := selectRepos(ts)
+	if serr != nil {
+		return serr
+	}
+	trs, lerr := client.LoadTransfers()
+	if lerr != nil {
+		return lerr
+	}
+	log.Printf("Transferring %d repos to org %s\n", len(rs), target.Org)
+	var done, failed int
+	for i, r := range rs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		tr, ok := trs[r.Name]
+		if ok && tr.Done() {
+			log.Printf("[%d/%d] Repo %s already transferred\n", i+1, len(rs), r.Name)
+			done++
+			continue
+		}
+		if !ok {
+			tr = &ghapi.TransferRecord{
+				Repository: r.Name,
+				NewName:    r.Name,
+				TargetOrg:  target.Org,
+			}
+		}
+		log.Printf("[%d/%d] Transferring repo: %s\n", i+1, len(rs), r.Name)
+		terr := transferRepo(ctx, r, tr, ts)
+		if *dryRun {
+			if terr != nil {
+				failed++
+				fmt.Printf("%s: cannot transfer: %v\n", r.Name, terr)
+			}
+			continue
+		}
+		tr.At = time.Now().UTC()
+		tr.Error = ""
+		if terr != nil {
+			tr.Error = terr.Error()
+		}
+		trs[r.Name] = tr
+		if serr := client.SaveTransfers(trs); serr != nil {
+			return serr
+		}
+		if tr.Done() {
+			done++
+		} else {
+			failed++
+			fmt.Printf("%s: failed: %v\n", r.Name, transferError(tr))
+		}
+	}
+	if *dryRun {
+		if failed > 0 {
+			return fmt.Errorf("%d of %d repos cannot be transferred", failed, len(rs))
+		}
+		return nil
+	}
+	fmt.Printf("Transferred: %d, failed: %d\n", done, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repos could not be transferred, run again to resume", failed, len(rs))
+	}
+	return nil
+}
+
+// transferError describes why tr is not done
+func transferError(tr *ghapi.TransferRecord) string {
+	if tr.Error != "" {
+		return tr.Error
+	}
+	var es []string
+	for _, ta := range tr.Teams {
+		if ta.Error != "" {
+			es = append(es, "team "+ta.Slug+": "+ta.Error)
+		}
+	}
+	return strings.Join(es, "; ")
+}
+
+// transferRepo transfers r unless tr records it as transferred, then re-attaches
+// the teams not yet done
+func transferRepo(ctx context.Context, r *ghapi.Repository, tr *ghapi.TransferRecord, ts []*ghapi.Team) error {
+	if tr.Teams == nil {
+		tr.Teams = repoTeamAccess(ts, r.Name)
+	}
+	if !tr.Transferred {
+		// GitHub redirects requests for a transferred repo, so this also finds one
+		// transferred by a run that stopped before recording it
+		sr, gerr := client.GetRepositoryContext(ctx, r.Name)
+		if gerr != nil {
+			return gerr
+		}
+		if strings.EqualFold(sr.Owner.Login, target.Org) {
+			tr.NewName = sr.Name
+			tr.Transferred = true
+		}
+	}
+	if !tr.Transferred {
+		_, cerr := target.GetRepositoryContext(ctx, tr.NewName)
+		if cerr == nil {
+			if !*transferRename {
+				return errors.New("repo " + tr.NewName + " already exists in org " + target.Org)
+			}
+			tr.NewName = r.Name + "-" + client.Org
+			if _, rerr := target.GetRepositoryContext(ctx, tr.NewName); rerr == nil {
+				return errors.New("repo " + tr.NewName + " already exists in org " + target.Org)
+			} else if !ghapi.IsNotFound(rerr) {
+				return rerr
+			}
+		} else if !ghapi.IsNotFound(cerr) {
+			return cerr
+		}
+		if *dryRun {
+			ps := &planStep{
+				Action:     "transfer_repo",
+				Repository: r.Name,
+			}
+			if tr.NewName != r.Name {
+				ps.NewName = tr.NewName
+			}
+			plan = append(plan, ps)
+		} else {
+			var newName string
+			if tr.NewName != r.Name {
+				newName = tr.NewName
+			}
+			if terr := client.TransferRepositoryContext(ctx, r, target.Org, newName); terr != nil {
+				return terr
+			}
+			tr.Transferred = true
+		}
+	}
+	if *dryRun {
+		for _, ta := range tr.Teams {
+			if !ta.Done {
+				plan = append(plan, &planStep{
+					Action:     "grant_team_repo",
+					Team:       ta.Slug,
+					Role:       ta.Permission,
+					Repository: tr.NewName,
+				})
+			}
+		}
+		return nil
+	}
+	if _, werr := target.WaitForRepositoryContext(ctx, tr.NewName); werr != nil {
+		return werr
+	}
+	for _, ta := range tr.Teams {
+		if ta.Done {
+			continue
+		}
+		ta.Error = ""
+		aerr := target.AddTeamRepoContext(ctx, &ghapi.Team{Slug: ta.Slug}, tr.NewName, ta.Permission)
+		if ghapi.IsNotFound(aerr) {
+			ta.Error = "team not found in org " + target.Org
+		} else if aerr != nil {
+			ta.Error = aerr.Error()
+		} else {
+			ta.Done = true
+		}
+	}
+	return nil
+}
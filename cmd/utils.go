@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,116 +9,212 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 
 	"github.com/umg/devops-github-migrate/ghapi"
 )
 
-func pullRepositories() {
-	rs, merr := ghapi.OrgRepositories()
+func pullRepositories(ctx context.Context) {
+	rs, merr := client.OrgRepositoriesContext(ctx)
 	if merr != nil {
 		log.Fatal(merr)
 	}
-	ghapi.SaveRepositories(rs)
+	if serr := client.SaveRepositories(rs); serr != nil {
+		log.Fatal(serr)
+	}
 }
 
-func pullMembership() {
-	ms, merr := ghapi.GetAllMembership()
+func pullMembership(ctx context.Context) {
+	ms, merr := client.GetAllMembershipContext(ctx)
 	if merr != nil {
 		log.Fatal(merr)
 	}
-	ghapi.SaveMembership(ms)
+	if serr := client.SaveMembership(ms); serr != nil {
+		log.Fatal(serr)
+	}
 }
 
-func pullInvitations() {
-	is, merr := ghapi.GetAllInvitations()
+func pullInvitations(ctx context.Context) {
+	is, merr := client.GetAllInvitationsContext(ctx)
 	if merr != nil {
 		log.Fatal(merr)
 	}
-	ghapi.SaveInvitations(is)
+	if serr := client.SaveInvitations(is); serr != nil {
+		log.Fatal(serr)
+	}
 }
 
-func pullOutsideCollaborators() {
-	cs, merr := ghapi.GetAllOutsideCollaborators()
+func pullOutsideCollaborators(ctx context.Context) {
+	cs, merr := client.GetAllOutsideCollaboratorsContext(ctx)
 	if merr != nil {
 		log.Fatal(merr)
 	}
-	ghapi.SaveOutsideCollaborators(cs)
+	if serr := client.SaveOutsideCollaborators(cs); serr != nil {
+		log.Fatal(serr)
+	}
+}
+
+func pullRepoCollaborators(ctx context.Context) {
+	rcs, rerr := client.GetAllRepoCollaboratorsContext(ctx)
+	if rerr != nil {
+		log.Fatal(rerr)
+	}
+	if serr := client.SaveRepoCollaborators(rcs); serr != nil {
+		log.Fatal(serr)
+	}
 }
 
-func pullUsers() {
-	us, uerr := ghapi.AllMembers()
+func pullUsers(ctx context.Context) {
+	us, uerr := client.AllMembersContext(ctx)
 	if uerr != nil {
 		log.Fatal(uerr)
 	}
-	for _, u := range us {
-		derr := u.GetDetails()
-		if derr != nil {
-			log.Fatal(derr)
-		}
+	derr := client.GetAllUserDetailsContext(ctx, us)
+	if derr != nil {
+		log.Fatal(derr)
+	}
+	if serr := client.SaveMemberList(us); serr != nil {
+		log.Fatal(serr)
 	}
-	ghapi.SaveMemberList(us)
 }
 
-func pullTeams() {
-	ts, terr := ghapi.AllTeams()
+func pullTeams(ctx context.Context) {
+	ts, terr := client.AllTeamsContext(ctx)
 	if terr != nil {
 		log.Fatal(terr)
 	}
-	for _, t := range ts {
-		derr := t.GetDetails()
-		if derr != nil {
-			log.Fatal(derr)
+	derr := client.GetAllTeamDetailsContext(ctx, ts)
+	if derr != nil {
+		log.Fatal(derr)
+	}
+	if serr := client.SaveTeamList(ts); serr != nil {
+		log.Fatal(serr)
+	}
+}
+
+// pullGraphQL pulls the selected data files using the GraphQL API
+func pullGraphQL(ctx context.Context, users, memberships, teams bool) {
+	if users || memberships {
+		us, ms, merr := client.GraphQLMembersContext(ctx)
+		if merr != nil {
+			log.Fatal(merr)
+		}
+		if users {
+			if serr := client.SaveMemberList(us); serr != nil {
+				log.Fatal(serr)
+			}
+		}
+		if memberships {
+			if serr := client.SaveMembership(ms); serr != nil {
+				log.Fatal(serr)
+			}
 		}
-		trs, terr := t.TeamRepositories()
+	}
+	if teams {
+		ts, terr := client.GraphQLTeamsContext(ctx)
 		if terr != nil {
 			log.Fatal(terr)
 		}
-		tms, merr := t.AllMembers()
-		if merr != nil {
-			log.Fatal(merr)
+		if serr := client.SaveTeamList(ts); serr != nil {
+			log.Fatal(serr)
 		}
-		t.Repositories = trs
-		t.Members = tms
 	}
-	ghapi.SaveTeamList(ts)
 }
 
-func migrateUser(u ghapi.User) error {
-	m, err := u.GetLocalMembership()
+// migrateUser removes u from the org, re-invites them and restores their teams once
+// the invitation is accepted. Each step is recorded in the ledger, so completed
+// steps are skipped and a migration waiting on acceptance resumes on the next run.
+func migrateUser(ctx context.Context, lg *ghapi.Ledger, u ghapi.User) error {
+	if *dryRun {
+		return planMigrateUser(ctx, lg, u)
+	}
+	rec := lg.Record(u.Login)
+	if rec.Done() {
+		log.Printf("User %s already migrated\n", u.Login)
+		return nil
+	}
+	m, err := client.GetLocalMembership(&u)
 	if err != nil {
 		return err
 	}
-	if m.URL != "" {
-		rerr := m.Remove()
-		if rerr != nil {
-			return rerr
-		}
-	} else {
-		err := u.GetDetails()
+	if m.URL == "" {
+		err := client.GetUserDetailsContext(ctx, &u)
 		if err != nil {
 			return err
 		}
 		m.User = u
 	}
-	ierr := m.Invite()
-	if ierr != nil {
-		return ierr
+	if !rec.StepDone(ghapi.StepRemoved) {
+		// Users migrated to another org keep their source membership, use -remove to drop it
+		if m.URL != "" && sameOrg() {
+			rerr := client.RemoveMemberContext(ctx, m)
+			if rerr != nil && !ghapi.IsNotFound(rerr) {
+				return lg.Fail(u.Login, ghapi.StepRemoved, rerr)
+			}
+		}
+		if lerr := lg.Complete(u.Login, ghapi.StepRemoved); lerr != nil {
+			return lerr
+		}
 	}
+	if !rec.StepDone(ghapi.StepInvited) {
+		ierr := target.InviteMemberContext(ctx, m)
+		if ierr != nil {
+			return lg.Fail(u.Login, ghapi.StepInvited, ierr)
+		}
+		if lerr := lg.Complete(u.Login, ghapi.StepInvited); lerr != nil {
+			return lerr
+		}
+	}
+	if !rec.StepDone(ghapi.StepAccepted) {
+		um, merr := target.GetUserMembershipContext(ctx, &m.User)
+		if merr != nil && !ghapi.IsNotFound(merr) {
+			return lg.Fail(u.Login, ghapi.StepAccepted, merr)
+		}
+		if um.State != "active" {
+			log.Printf("Invitation for %s not yet accepted, run -migrate again once accepted to restore teams\n", u.Login)
+			return nil
+		}
+		if lerr := lg.Complete(u.Login, ghapi.StepAccepted); lerr != nil {
+			return lerr
+		}
+	}
+	if !rec.StepDone(ghapi.StepTeamsRestored) {
+		terr := target.RestoreTeamMembershipsContext(ctx, &m.User)
+		if terr != nil {
+			return lg.Fail(u.Login, ghapi.StepTeamsRestored, terr)
+		}
+		if lerr := lg.Complete(u.Login, ghapi.StepTeamsRestored); lerr != nil {
+			return lerr
+		}
+	}
+	if !rec.StepDone(ghapi.StepReposRestored) {
+		perr := target.RestoreRepoPermissionsContext(ctx, &m.User)
+		if perr != nil {
+			return lg.Fail(u.Login, ghapi.StepReposRestored, perr)
+		}
+		if lerr := lg.Complete(u.Login, ghapi.StepReposRestored); lerr != nil {
+			return lerr
+		}
+	}
+	log.Printf("User %s migrated\n", u.Login)
 	return nil
 }
 
-func removeUser(u ghapi.User) error {
-	m, err := u.GetLocalMembership()
+func removeUser(ctx context.Context, u ghapi.User) error {
+	if *dryRun {
+		return planRemoveUser(u)
+	}
+	m, err := client.GetLocalMembership(&u)
 	if err != nil {
 		return err
 	}
 	if m.URL != "" {
-		rerr := m.Remove()
+		rerr := client.RemoveMemberContext(ctx, m)
 		if rerr != nil {
 			return rerr
 		}
 	} else {
-		err := u.GetDetails()
+		err := client.GetUserDetailsContext(ctx, &u)
 		if err != nil {
 			return err
 		}
@@ -126,18 +223,62 @@ func removeUser(u ghapi.User) error {
 	return nil
 }
 
-func printUserList(ul []*ghapi.User, d string) {
-	for _, lu := range ul {
-		val := reflect.ValueOf(lu).Elem()
-		for i := 0; i < val.NumField(); i++ {
-			valueField := val.Field(i)
-			typeField := val.Type().Field(i)
-			tag := typeField.Tag.Get("json")
-			if tag == d && valueField.String() != "" {
-				fmt.Println(valueField)
+func pullIdentities(ctx context.Context) {
+	ids, ierr := client.GetSSOIdentitiesContext(ctx)
+	if ierr != nil {
+		log.Fatal(ierr)
+	}
+	if serr := client.SaveSSOIdentities(ids); serr != nil {
+		log.Fatal(serr)
+	}
+}
+
+// jsonField returns the field of the struct v points to with JSON tag d, reporting whether there is one
+func jsonField(v interface{}, d string) (reflect.Value, bool) {
+	val := reflect.ValueOf(v).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		if val.Type().Field(i).Tag.Get("json") == d {
+			return val.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// printField prints the field of v with JSON tag d, reporting whether v has such a field
+func printField(v interface{}, d string) bool {
+	valueField, ok := jsonField(v, d)
+	if ok && valueField.String() != "" {
+		fmt.Println(valueField)
+	}
+	return ok
+}
+
+// printUserList prints field d for each user. Fields not found on the user are
+// read from the user's SSO identity, and users are filtered by the -sso flag.
+func printUserList(ul []*ghapi.User, d string) error {
+	var ids map[string]*ghapi.SSOIdentity
+	if _, ok := jsonField(new(ghapi.User), d); *sso != "" || !ok {
+		il, ierr := client.LoadSSOIdentities()
+		if ierr != nil {
+			return ierr
+		}
+		ids = make(map[string]*ghapi.SSOIdentity)
+		for _, id := range il {
+			if id.Login != "" {
+				ids[strings.ToLower(id.Login)] = id
 			}
 		}
 	}
+	for _, lu := range ul {
+		id := ids[strings.ToLower(lu.Login)]
+		if (*sso == "linked" && id == nil) || (*sso == "unlinked" && id != nil) {
+			continue
+		}
+		if !printField(lu, d) && id != nil {
+			printField(id, d)
+		}
+	}
+	return nil
 }
 
 func printUsers(d string) error {
@@ -155,8 +296,7 @@ func printUsers(d string) error {
 	if jerr != nil {
 		return jerr
 	}
-	printUserList(ul, d)
-	return nil
+	return printUserList(ul, d)
 }
 
 func printUsersInTeam(d string, t string) error {
@@ -182,8 +322,7 @@ func printUsersInTeam(d string, t string) error {
 			}
 		}
 	}
-	printUserList(ul, d)
-	return nil
+	return printUserList(ul, d)
 }
 
 func printTeams() error {
@@ -207,18 +346,18 @@ func printTeams() error {
 	return nil
 }
 
-func checkAndPull() {
+func checkAndPull(ctx context.Context) {
 	var pullReq bool
-	if _, err := os.Stat(path.Join(ghapi.DataDir, "memberships.json")); os.IsNotExist(err) {
+	if _, err := os.Stat(path.Join(client.DataDir, "memberships.json")); os.IsNotExist(err) {
 		pullReq = true
 	}
-	if _, err := os.Stat(path.Join(ghapi.DataDir, "teams.json")); os.IsNotExist(err) {
+	if _, err := os.Stat(path.Join(client.DataDir, "teams.json")); os.IsNotExist(err) {
 		pullReq = true
 	}
-	if _, err := os.Stat(path.Join(ghapi.DataDir, "users.json")); os.IsNotExist(err) {
+	if _, err := os.Stat(path.Join(client.DataDir, "users.json")); os.IsNotExist(err) {
 		pullReq = true
 	}
 	if pullReq {
-		pullAll()
+		pullAll(ctx)
 	}
 }
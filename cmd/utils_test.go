@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/umg/devops-github-migrate/ghapi"
+)
+
+// captureStdout returns what f prints to stdout
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	w.Close()
+	out, rerr := ioutil.ReadAll(r)
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return string(out)
+}
+
+func TestJSONField(t *testing.T) {
+	u := &ghapi.User{Login: "octocat", ID: 583231, SiteAdmin: true}
+	if v, ok := jsonField(u, "id"); !ok || v.Int() != 583231 {
+		t.Errorf("jsonField(id) = %v, %v, want 583231, true", v, ok)
+	}
+	if v, ok := jsonField(u, "login"); !ok || v.String() != "octocat" {
+		t.Errorf("jsonField(login) = %v, %v, want octocat, true", v, ok)
+	}
+	if _, ok := jsonField(u, "name_id"); ok {
+		t.Error("jsonField(name_id) found a field on User")
+	}
+	if _, ok := jsonField(new(ghapi.SSOIdentity), "name_id"); !ok {
+		t.Error("jsonField(name_id) found no field on SSOIdentity")
+	}
+}
+
+func TestPrintUserList(t *testing.T) {
+	sso = new(string)
+	defer func() { sso = nil }()
+	ul := []*ghapi.User{
+		{Login: "octocat", ID: 583231, SiteAdmin: true},
+		{Login: "hubot", ID: 1},
+	}
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"login", "octocat\nhubot\n"},
+		{"id", "583231\n1\n"},
+		{"site_admin", "true\nfalse\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var err error
+			out := captureStdout(t, func() {
+				err = printUserList(ul, tt.data)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.want {
+				t.Errorf("printUserList() printed %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
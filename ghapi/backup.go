@@ -0,0 +1,220 @@
+package ghapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackupRecord records the last sync of a repository mirror
+type BackupRecord struct {
+	Repository    string `json:"repository"`
+	Path          string `json:"path"`
+	DefaultBranch string `json:"default_branch"`
+	// Commit is the commit the default branch pointed to when last synced, empty for an empty repository
+	Commit     string `json:"commit"`
+	Archived   bool   `json:"archived"`
+	Wiki       string `json:"wiki,omitempty"`
+	WikiCommit string `json:"wiki_commit,omitempty"`
+	// SyncedAt is the time of the last successful sync
+	SyncedAt time.Time `json:"synced_at"`
+	// Error is the error of the last sync, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// CloneURL returns the git URL of r
+func (r *Repository) CloneURL() string {
+	return strings.TrimSuffix(r.HTMLURL, "/") + ".git"
+}
+
+// WikiCloneURL returns the git URL of the wiki of r
+func (r *Repository) WikiCloneURL() string {
+	return strings.TrimSuffix(r.HTMLURL, "/") + ".wiki.git"
+}
+
+// git runs a git command authenticated with the client token, returning its trimmed output
+func (c *Client) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// The token is passed in the environment, not the URL, so that it is not stored in the mirror's config
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + c.Token))
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	} else if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", err
+		}
+		return "", errors.New(err.Error() + ": " + msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// mirror makes a bare mirror clone of url at dst, or fetches into dst if it exists,
+// and returns the commit branch points to, or HEAD if branch is empty
+func (c *Client) mirror(ctx context.Context, url, dst, branch string) (string, error) {
+	if _, serr := os.Stat(dst); os.IsNotExist(serr) {
+		// Clone into a temporary directory so an interrupted clone is not taken for a mirror
+		tmp := dst + ".tmp"
+		if rerr := os.RemoveAll(tmp); rerr != nil {
+			return "", rerr
+		}
+		if _, cerr := c.git(ctx, "clone", "--mirror", "--quiet", url, tmp); cerr != nil {
+			os.RemoveAll(tmp)
+			return "", cerr
+		}
+		if rerr := os.Rename(tmp, dst); rerr != nil {
+			return "", rerr
+		}
+	} else if serr != nil {
+		return "", serr
+	} else if _, ferr := c.git(ctx, "--git-dir", dst, "remote", "update", "--prune"); ferr != nil {
+		return "", ferr
+	}
+	// The mirror's HEAD is not updated by fetches, so follow the default branch instead
+	ref := "HEAD"
+	if branch != "" {
+		ref = "refs/heads/" + branch
+	}
+	// An empty repository has no commit to resolve
+	commit, _ := c.git(ctx, "--git-dir", dst, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return commit, ctx.Err()
+}
+
+// BackupRepository mirrors r into dir, along with its wiki if it has one.
+// prev is the manifest record of the previous sync, or nil.
+func (c *Client) BackupRepository(r *Repository, dir string, prev *BackupRecord) (*BackupRecord, error) {
+	return c.BackupRepositoryContext(context.Background(), r, dir, prev)
+}
+
+// BackupRepositoryContext is BackupRepository with a context controlling cancellation.
+// A failed sync is recorded in the returned record, which keeps the commit of the
+// previous sync as the mirror is left as it was.
+func (c *Client) BackupRepositoryContext(ctx context.Context, r *Repository, dir string, prev *BackupRecord) (*BackupRecord, error) {
+	br := &BackupRecord{}
+	if prev != nil {
+		*br = *prev
+	}
+	br.Repository = r.Name
+	br.Path = r.Name + ".git"
+	br.DefaultBranch = r.DefaultBranch
+	br.Archived = r.Archived
+	log.SetOutput(os.Stdout)
+	log.Printf("Backing up repo: %s\n", r.Name)
+	commit, err := c.mirror(ctx, r.CloneURL(), path.Join(dir, br.Path), r.DefaultBranch)
+	if err != nil {
+		br.Error = err.Error()
+		return br, err
+	}
+	br.Commit = commit
+	br.Wiki = ""
+	br.WikiCommit = ""
+	if r.HasWiki {
+		wp := r.Name + ".wiki.git"
+		wc, werr := c.mirror(ctx, r.WikiCloneURL(), path.Join(dir, wp), "")
+		if werr != nil && strings.Contains(strings.ToLower(werr.Error()), "not found") && ctx.Err() == nil {
+			// GitHub only creates the wiki repository once its first page is saved
+			log.Printf("Repo %s has no wiki pages\n", r.Name)
+		} else if werr != nil {
+			br.Error = "wiki: " + werr.Error()
+			return br, werr
+		} else {
+			br.Wiki = wp
+			br.WikiCommit = wc
+		}
+	}
+	br.Error = ""
+	br.SyncedAt = time.Now().UTC()
+	return br, nil
+}
+
+// BackupRepositories mirrors each of rs into dir, c.Concurrency at a time. manifest.json
+// in dir is updated after each repository, and failures are recorded there rather than
+// stopping the backup. The records of rs are returned in order.
+func (c *Client) BackupRepositories(rs []*Repository, dir string) ([]*BackupRecord, error) {
+	return c.BackupRepositoriesContext(context.Background(), rs, dir)
+}
+
+// BackupRepositoriesContext is BackupRepositories with a context controlling cancellation
+func (c *Client) BackupRepositoriesContext(ctx context.Context, rs []*Repository, dir string) ([]*BackupRecord, error) {
+	brs := make([]*BackupRecord, len(rs))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return brs, err
+	}
+	m, merr := LoadBackupManifest(dir)
+	if merr != nil {
+		return brs, merr
+	}
+	var mu sync.Mutex
+	err := c.forEach(ctx, len(rs), func(ctx context.Context, i int) error {
+		mu.Lock()
+		prev := m[rs[i].Name]
+		mu.Unlock()
+		br, berr := c.BackupRepositoryContext(ctx, rs[i], dir, prev)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if berr != nil {
+			log.Printf("Error backing up repo %s: %s\n", rs[i].Name, berr)
+		}
+		brs[i] = br
+		mu.Lock()
+		defer mu.Unlock()
+		m[br.Repository] = br
+		return SaveBackupManifest(dir, m)
+	})
+	return brs, err
+}
+
+// LoadBackupManifest loads the backup records in manifest.json in dir, keyed by repository name
+func LoadBackupManifest(dir string) (map[string]*BackupRecord, error) {
+	m := make(map[string]*BackupRecord)
+	bd, rerr := ioutil.ReadFile(path.Join(dir, "manifest.json"))
+	if os.IsNotExist(rerr) {
+		return m, nil
+	} else if rerr != nil {
+		return m, rerr
+	}
+	var brs []*BackupRecord
+	if jerr := json.Unmarshal(bd, &brs); jerr != nil {
+		return m, jerr
+	}
+	for _, br := range brs {
+		m[br.Repository] = br
+	}
+	return m, nil
+}
+
+// SaveBackupManifest saves backup records to manifest.json in dir
+func SaveBackupManifest(dir string, m map[string]*BackupRecord) error {
+	var brs []*BackupRecord
+	for _, br := range m {
+		brs = append(brs, br)
+	}
+	sort.Slice(brs, func(i, j int) bool {
+		return brs[i].Repository < brs[j].Repository
+	})
+	jd, jerr := json.Marshal(brs)
+	if jerr != nil {
+		return jerr
+	}
+	return writeDataFile(path.Join(dir, "manifest.json"), jd)
+}
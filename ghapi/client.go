@@ -0,0 +1,191 @@
+package ghapi
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the public GitHub API endpoint
+	DefaultBaseURL = "https://api.github.com"
+	// DefaultTimeout is the default timeout for a single API request
+	DefaultTimeout = time.Minute
+)
+
+// Client is a GitHub API client bound to a single organization
+type Client struct {
+	// BaseURL is the root URL of the GitHub API, e.g. https://ghe.example.com/api/v3 for GitHub Enterprise Server
+	BaseURL string
+	// Org is the GitHub organization
+	Org string
+	// Token is the GitHub auth token. Must have proper access to org.
+	Token string
+	// DataDir is the directory in which data is stored
+	DataDir string
+	// Timeout is the timeout for a single API request
+	Timeout time.Duration
+	// Transport is used to send API requests. Defaults to http.DefaultTransport
+	Transport http.RoundTripper
+	// RateLimiter throttles requests against the API rate limit
+	RateLimiter *RateLimiter
+	// Retry controls how transient failures are retried
+	Retry RetryPolicy
+	// Concurrency is the number of per-user or per-team requests run in parallel
+	Concurrency int
+	// ReadOnly rejects REST requests that would change state with ErrReadOnly
+	ReadOnly bool
+
+	once     sync.Once
+	hc       *http.Client
+	snapshot *Snapshot
+	// teamIDs maps team slugs to IDs in Org, set by MapTeams
+	teamIDs map[string]int
+}
+
+// NewClient creates a client for org using the default API endpoint
+func NewClient(org, token, dataDir string) *Client {
+	return &Client{
+		BaseURL:     DefaultBaseURL,
+		Org:         org,
+		Token:       token,
+		DataDir:     dataDir,
+		Timeout:     DefaultTimeout,
+		RateLimiter: NewRateLimiter(DefaultRateLimitLowWater),
+		Retry:       DefaultRetryPolicy,
+		Concurrency: 1,
+	}
+}
+
+// RateLimit returns the most recently observed API rate limit, or nil if none has been seen
+func (c *Client) RateLimit() *RateLimit {
+	return c.RateLimiter.Current(CoreResource)
+}
+
+// httpClient returns the underlying HTTP client, created on first use
+func (c *Client) httpClient() *http.Client {
+	c.once.Do(func() {
+		c.hc = &http.Client{
+			Timeout:   c.Timeout,
+			Transport: c.Transport,
+		}
+	})
+	return c.hc
+}
+
+// url returns the full API URL for path p
+func (c *Client) url(p string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + p
+}
+
+// GraphQLURL returns the GraphQL endpoint for BaseURL.
+// GitHub Enterprise Server serves REST under /api/v3 and GraphQL under /api/graphql.
+func (c *Client) GraphQLURL() string {
+	base := strings.TrimSuffix(c.BaseURL, "/")
+	if strings.HasSuffix(base, "/api/v3") {
+		return strings.TrimSuffix(base, "/v3") + "/graphql"
+	}
+	return base + "/graphql"
+}
+
+// newRequest creates an authenticated API request for path p
+func (c *Client) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	return c.newRequestURL(ctx, method, c.url(p), body)
+}
+
+// newRequestURL creates an authenticated API request for the full URL u
+func (c *Client) newRequestURL(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return req, err
+	}
+	req.Header.Set("Authorization", "token "+c.Token)
+	return req, nil
+}
+
+// do sends an API request. It waits out the rate limit before sending,
+// resends requests rejected by a rate limit, and retries idempotent
+// requests that fail with a transient error. Waiting stops when the
+// request context is done.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.ReadOnly && req.Method != "GET" && req.Method != "HEAD" {
+		return nil, ErrReadOnly
+	}
+	return c.send(req, idempotent(req.Method))
+}
+
+// send is do with explicit control over whether transient failures are retried
+func (c *Client) send(req *http.Request, retry bool) (*http.Response, error) {
+	ctx := req.Context()
+	resource := CoreResource
+	if req.URL.String() == c.GraphQLURL() {
+		resource = GraphQLResource
+	}
+	attempt := 1
+	waits := 0
+	for {
+		if werr := c.RateLimiter.Wait(ctx, resource); werr != nil {
+			return nil, werr
+		}
+		res, err := c.httpClient().Do(req)
+		if err != nil {
+			if !retry || !retryableError(err) || !c.Retry.retry(attempt) {
+				return res, err
+			}
+			if berr := c.backoff(req, attempt, err.Error()); berr != nil {
+				return nil, berr
+			}
+			attempt++
+		} else {
+			rl, rlerr := ParseRateLimit(res)
+			if rlerr != nil {
+				res.Body.Close()
+				return res, rlerr
+			}
+			c.RateLimiter.Update(rl)
+			if wait, limited := rateLimitWait(res, rl); limited && waits < maxRateLimitWaits {
+				res.Body.Close()
+				log.SetOutput(os.Stdout)
+				log.Printf("Rate limited on %s %s (HTTP %d), retrying in %s\n", req.Method, req.URL.Path, res.StatusCode, wait.Round(time.Second))
+				c.RateLimiter.Pause(wait)
+				waits++
+			} else if retry && retryableStatus(res.StatusCode) && c.Retry.retry(attempt) {
+				res.Body.Close()
+				if berr := c.backoff(req, attempt, res.Status); berr != nil {
+					return nil, berr
+				}
+				attempt++
+			} else {
+				return res, nil
+			}
+		}
+		if rerr := rewindBody(req); rerr != nil {
+			return nil, rerr
+		}
+	}
+}
+
+// backoff logs a failed attempt and sleeps before the next one
+func (c *Client) backoff(req *http.Request, attempt int, reason string) error {
+	d := c.Retry.Backoff(attempt)
+	log.SetOutput(os.Stdout)
+	log.Printf("%s %s failed (%s), attempt %d of %d, retrying in %s\n", req.Method, req.URL.Path, reason, attempt, c.Retry.MaxAttempts, d.Round(time.Millisecond))
+	return sleep(req.Context(), d)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
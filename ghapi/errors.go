@@ -0,0 +1,108 @@
+package ghapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrReadOnly is returned for a request that would change state on a ReadOnly client
+var ErrReadOnly = errors.New("ghapi: client is read-only")
+
+// APIError is returned when the GitHub API responds with a failure status
+type APIError struct {
+	GitHubError
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Method and URL identify the failed request
+	Method string
+	URL    string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	var fes []string
+	for _, fe := range e.Errors {
+		fes = append(fes, fe.String())
+	}
+	if len(fes) > 0 {
+		msg += " [" + strings.Join(fes, "; ") + "]"
+	}
+	return msg
+}
+
+func (e GitHubResponseError) String() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return strings.TrimSpace(e.Resource + " " + e.Field + " " + e.Code)
+}
+
+// checkResponse returns an *APIError decoded from bd if res has a failure status
+func checkResponse(res *http.Response, bd []byte) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	ae := &APIError{
+		StatusCode: res.StatusCode,
+	}
+	if res.Request != nil {
+		ae.Method = res.Request.Method
+		ae.URL = res.Request.URL.String()
+	}
+	if jerr := json.Unmarshal(bd, &ae.GitHubError); jerr != nil {
+		ae.Message = strings.TrimSpace(string(bd))
+	}
+	return ae
+}
+
+// statusOf returns the HTTP status of an *APIError in err's chain, or 0
+func statusOf(err error) int {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return ae.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 from the API
+func IsNotFound(err error) bool {
+	return statusOf(err) == http.StatusNotFound
+}
+
+// IsForbidden reports whether err is a 403 from the API that is not a rate limit
+func IsForbidden(err error) bool {
+	return statusOf(err) == http.StatusForbidden && !IsRateLimited(err)
+}
+
+// IsUnprocessable reports whether err is a 422 validation failure from the API
+func IsUnprocessable(err error) bool {
+	return statusOf(err) == http.StatusUnprocessableEntity
+}
+
+// IsRateLimited reports whether err is a primary or secondary rate limit rejection from the API
+func IsRateLimited(err error) bool {
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		return false
+	}
+	if ae.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	msg := strings.ToLower(ae.Message)
+	return ae.StatusCode == http.StatusForbidden && (strings.Contains(msg, "rate limit") || strings.Contains(msg, "abuse"))
+}
+
+// isTransient reports whether a failed request may succeed if sent again
+func isTransient(err error) bool {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return retryableStatus(ae.StatusCode)
+	}
+	return retryableError(err)
+}
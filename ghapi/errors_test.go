@@ -0,0 +1,127 @@
+package ghapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// apiError returns the error checkResponse decodes from a GET response with status and body
+func apiError(status int, body string) error {
+	u, _ := url.Parse("https://api.github.com/orgs/o/members")
+	res := &http.Response{
+		StatusCode: status,
+		Request:    &http.Request{Method: "GET", URL: u},
+	}
+	return checkResponse(res, []byte(body))
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"ok", http.StatusOK, `{"message":"ignored"}`, ""},
+		{"no content", http.StatusNoContent, "", ""},
+		{"not found", http.StatusNotFound, `{"message":"Not Found","documentation_url":"https://docs.github.com"}`,
+			"GET https://api.github.com/orgs/o/members: 404 Not Found: Not Found"},
+		{"validation errors", http.StatusUnprocessableEntity, `{"message":"Validation Failed","errors":[{"resource":"Invitation","field":"invitee_id","code":"invalid"},{"message":"already a member"}]}`,
+			"GET https://api.github.com/orgs/o/members: 422 Unprocessable Entity: Validation Failed [Invitation invitee_id invalid; already a member]"},
+		{"body not json", http.StatusBadGateway, "<html>Bad Gateway</html>\n",
+			"GET https://api.github.com/orgs/o/members: 502 Bad Gateway: <html>Bad Gateway</html>"},
+		{"empty body", http.StatusInternalServerError, "",
+			"GET https://api.github.com/orgs/o/members: 500 Internal Server Error"},
+		{"redirect", http.StatusMovedPermanently, `{"message":"Moved Permanently"}`,
+			"GET https://api.github.com/orgs/o/members: 301 Moved Permanently: Moved Permanently"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := apiError(tt.status, tt.body)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("checkResponse() = %v, want nil", err)
+				}
+				return
+			}
+			var ae *APIError
+			if !errors.As(err, &ae) {
+				t.Fatalf("checkResponse() = %v, want *APIError", err)
+			}
+			if ae.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", ae.StatusCode, tt.status)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		name                                            string
+		err                                             error
+		notFound, forbidden, rateLimited, unprocessable bool
+	}{
+		{"nil", nil, false, false, false, false},
+		{"not api error", errors.New("rate limit"), false, false, false, false},
+		{"not found", apiError(http.StatusNotFound, `{"message":"Not Found"}`), true, false, false, false},
+		{"wrapped not found", fmt.Errorf("team a: %w", apiError(http.StatusNotFound, `{"message":"Not Found"}`)), true, false, false, false},
+		{"forbidden", apiError(http.StatusForbidden, `{"message":"Must have admin rights to Repository."}`), false, true, false, false},
+		{"primary rate limit", apiError(http.StatusForbidden, `{"message":"API rate limit exceeded for user ID 1."}`), false, false, true, false},
+		{"secondary rate limit", apiError(http.StatusForbidden, `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`), false, false, true, false},
+		{"abuse detection", apiError(http.StatusForbidden, `{"message":"You have triggered an abuse detection mechanism."}`), false, false, true, false},
+		{"too many requests", apiError(http.StatusTooManyRequests, ""), false, false, true, false},
+		{"rate limit message on 404", apiError(http.StatusNotFound, `{"message":"rate limit"}`), true, false, false, false},
+		{"unprocessable", apiError(http.StatusUnprocessableEntity, `{"message":"Validation Failed"}`), false, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNotFound(tt.err); got != tt.notFound {
+				t.Errorf("IsNotFound() = %v, want %v", got, tt.notFound)
+			}
+			if got := IsForbidden(tt.err); got != tt.forbidden {
+				t.Errorf("IsForbidden() = %v, want %v", got, tt.forbidden)
+			}
+			if got := IsRateLimited(tt.err); got != tt.rateLimited {
+				t.Errorf("IsRateLimited() = %v, want %v", got, tt.rateLimited)
+			}
+			if got := IsUnprocessable(tt.err); got != tt.unprocessable {
+				t.Errorf("IsUnprocessable() = %v, want %v", got, tt.unprocessable)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad gateway", apiError(http.StatusBadGateway, ""), true},
+		{"service unavailable", apiError(http.StatusServiceUnavailable, ""), true},
+		{"not found", apiError(http.StatusNotFound, ""), false},
+		{"rate limited", apiError(http.StatusTooManyRequests, ""), false},
+		{"timeout", &url.Error{Op: "Get", URL: "https://api.github.com", Err: &timeoutError{}}, true},
+		{"other error", errors.New("invalid character"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -1,21 +1,8 @@
 package ghapi
 
 import (
-	"log"
-	"net/http"
-	"regexp"
-	"strconv"
-	"strings"
-	"time"
-)
-
-var (
-	// Org is the GitHub organization
-	Org string
-	// DataDir is the directory in which data is stored
-	DataDir string
-	// Token is the GitHub auth token. Must have proper access to org.
-	Token string
+	"io/ioutil"
+	"os"
 )
 
 type oathReq struct {
@@ -60,83 +47,16 @@ type GitHubResponseError struct {
 	Resource string `json:"resource"`
 	Code     string `json:"code"`
 	Field    string `json:"field"`
+	Message  string `json:"message"`
 }
 
-// RateLimit contains the rate limit data
-type RateLimit struct {
-	Limit     int
-	Remaining int
-	Reset     int
-}
-
-// ListPages returns the pages in the list query
-type ListPages struct {
-	Prev int
-	Next int
-	Last int
-}
-
-// ParseRateLimit parses the rate limit from headers
-func ParseRateLimit(res *http.Response) (*RateLimit, error) {
-	var rl *RateLimit
-	var err error
-	var rlim int
-	var rrem int
-	var rres int
-	rlim, err = strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
-	if err != nil {
-		return rl, err
-	}
-	rrem, err = strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
-	if err != nil {
-		return rl, err
-	}
-	rres, err = strconv.Atoi(res.Header.Get("X-RateLimit-Reset"))
-	if err != nil {
-		return rl, err
-	}
-	rl = &RateLimit{
-		Limit:     rlim,
-		Remaining: rrem,
-		Reset:     rres,
-	}
-	if rl.Remaining <= 50 {
-		log.Printf("Rate Limit Reached, sleeping for %d ms", rl.Reset)
-		time.Sleep(time.Millisecond * time.Duration(rl.Reset))
-	}
-	return rl, nil
-}
-
-func pageFromLink(link string) (int, error) {
-	nr := regexp.MustCompile("/?page=.*>")
-	np := nr.FindString(link)
-	nextPageStr := strings.Replace(np, "page=", "", -1)
-	nextPageStr = strings.Replace(nextPageStr, ">", "", -1)
-	intPage, nerr := strconv.Atoi(nextPageStr)
-	if nerr != nil {
-		return intPage, nerr
-	}
-	return intPage, nil
-}
-
-func parseLinks(links string) (ListPages, error) {
-	var lp ListPages
-	var err error
-	lar := strings.Split(links, ",")
-	for _, v := range lar {
-		if strings.Contains(v, "rel=\"next\"") {
-			var np int
-			np, err = pageFromLink(v)
-			lp.Next = np
-		} else if strings.Contains(v, "rel=\"prev\"") {
-			var pp int
-			pp, err = pageFromLink(v)
-			lp.Prev = pp
-		} else if strings.Contains(v, "rel=\"last\"") {
-			var lap int
-			lap, err = pageFromLink(v)
-			lp.Last = lap
-		}
+// writeDataFile replaces a data file by writing to a temporary file and renaming it,
+// so an interrupted run never leaves a partially written file behind
+func writeDataFile(name string, jd []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, jd, 0755); err != nil {
+		os.Remove(tmp)
+		return err
 	}
-	return lp, err
+	return os.Rename(tmp, name)
 }
@@ -0,0 +1,82 @@
+package ghapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+// GraphQLError is a single error returned by the GraphQL API
+type GraphQLError struct {
+	Type    string        `json:"type"`
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path"`
+}
+
+// GraphQLErrors is returned when a GraphQL response carries errors
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	var ms []string
+	for _, ge := range e {
+		ms = append(ms, ge.Message)
+	}
+	return "graphql: " + strings.Join(ms, "; ")
+}
+
+// pageInfo is the GraphQL connection cursor
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// GraphQL runs query with vars against the GraphQL API and decodes the response data into v
+func (c *Client) GraphQL(query string, vars map[string]interface{}, v interface{}) error {
+	return c.GraphQLContext(context.Background(), query, vars, v)
+}
+
+// GraphQLContext is GraphQL with a context controlling cancellation
+func (c *Client) GraphQLContext(ctx context.Context, query string, vars map[string]interface{}, v interface{}) error {
+	type params struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}
+	jd, jerr := json.Marshal(&params{
+		Query:     query,
+		Variables: vars,
+	})
+	if jerr != nil {
+		return jerr
+	}
+	req, err := c.newRequestURL(ctx, "POST", c.GraphQLURL(), bytes.NewBuffer(jd))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Queries do not change state, so they are safe to retry
+	res, rerr := c.send(req, true)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
+	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return cerr
+	}
+	var gr struct {
+		Data   json.RawMessage `json:"data"`
+		Errors GraphQLErrors   `json:"errors"`
+	}
+	if uerr := json.Unmarshal(bd, &gr); uerr != nil {
+		return uerr
+	}
+	if len(gr.Errors) > 0 {
+		return gr.Errors
+	}
+	return json.Unmarshal(gr.Data, v)
+}
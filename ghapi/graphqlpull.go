@@ -0,0 +1,465 @@
+package ghapi
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gqlOrganization is the organization as returned by GraphQL
+type gqlOrganization struct {
+	DatabaseID  int    `json:"databaseId"`
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Email       string `json:"email"`
+	Location    string `json:"location"`
+	WebsiteURL  string `json:"websiteUrl"`
+	URL         string `json:"url"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+// gqlUser is a user as returned by GraphQL
+type gqlUser struct {
+	DatabaseID  int    `json:"databaseId"`
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Company     string `json:"company"`
+	Location    string `json:"location"`
+	Bio         string `json:"bio"`
+	WebsiteURL  string `json:"websiteUrl"`
+	AvatarURL   string `json:"avatarUrl"`
+	URL         string `json:"url"`
+	IsHireable  bool   `json:"isHireable"`
+	IsSiteAdmin bool   `json:"isSiteAdmin"`
+}
+
+// gqlRepository is a repository as returned by GraphQL
+type gqlRepository struct {
+	DatabaseID       int    `json:"databaseId"`
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	NameWithOwner    string `json:"nameWithOwner"`
+	Description      string `json:"description"`
+	URL              string `json:"url"`
+	HomepageURL      string `json:"homepageUrl"`
+	IsPrivate        bool   `json:"isPrivate"`
+	IsFork           bool   `json:"isFork"`
+	IsArchived       bool   `json:"isArchived"`
+	IsDisabled       bool   `json:"isDisabled"`
+	IsTemplate       bool   `json:"isTemplate"`
+	HasIssuesEnabled bool   `json:"hasIssuesEnabled"`
+	HasWikiEnabled   bool   `json:"hasWikiEnabled"`
+	ForkCount        int    `json:"forkCount"`
+	DiskUsage        int    `json:"diskUsage"`
+	PushedAt         string `json:"pushedAt"`
+	CreatedAt        string `json:"createdAt"`
+	UpdatedAt        string `json:"updatedAt"`
+	Owner            struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PrimaryLanguage struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	DefaultBranchRef struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+}
+
+// gqlTeam is a team as returned by GraphQL
+type gqlTeam struct {
+	DatabaseID  int    `json:"databaseId"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Privacy     string `json:"privacy"`
+	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
+	ParentTeam  *struct {
+		DatabaseID  int    `json:"databaseId"`
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		Slug        string `json:"slug"`
+		Description string `json:"description"`
+		Privacy     string `json:"privacy"`
+	} `json:"parentTeam"`
+	Members      gqlTeamMembers `json:"members"`
+	Repositories gqlTeamRepos   `json:"repositories"`
+}
+
+type gqlTeamMembers struct {
+	TotalCount int      `json:"totalCount"`
+	PageInfo   pageInfo `json:"pageInfo"`
+	Edges      []struct {
+		Role string  `json:"role"`
+		Node gqlUser `json:"node"`
+	} `json:"edges"`
+}
+
+type gqlTeamRepos struct {
+	TotalCount int      `json:"totalCount"`
+	PageInfo   pageInfo `json:"pageInfo"`
+	Edges      []struct {
+		Permission string        `json:"permission"`
+		Node       gqlRepository `json:"node"`
+	} `json:"edges"`
+}
+
+const gqlUserFields = `databaseId id login name email company location bio websiteUrl avatarUrl url isHireable isSiteAdmin`
+
+const gqlRepoFields = `databaseId id name nameWithOwner description url homepageUrl isPrivate isFork isArchived isDisabled isTemplate
+	hasIssuesEnabled hasWikiEnabled forkCount diskUsage pushedAt createdAt updatedAt
+	owner { login } primaryLanguage { name } defaultBranchRef { name }`
+
+const gqlMembersQuery = `query($org: String!, $cursor: String) {
+  organization(login: $org) {
+    databaseId id login name description email location websiteUrl url createdAt
+    membersWithRole(first: 100, after: $cursor) {
+      pageInfo { hasNextPage endCursor }
+      edges { role node { ` + gqlUserFields + ` } }
+    }
+  }
+}`
+
+const gqlTeamsQuery = `query($org: String!, $cursor: String) {
+  organization(login: $org) {
+    databaseId id login name description email location websiteUrl url createdAt
+    teams(first: 50, after: $cursor) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        databaseId id name slug description privacy createdAt updatedAt
+        parentTeam { databaseId id name slug description privacy }
+        members(first: 100) {
+          totalCount
+          pageInfo { hasNextPage endCursor }
+          edges { role node { ` + gqlUserFields + ` } }
+        }
+        repositories(first: 100) {
+          totalCount
+          pageInfo { hasNextPage endCursor }
+          edges { permission node { ` + gqlRepoFields + ` } }
+        }
+      }
+    }
+  }
+}`
+
+const gqlTeamMembersQuery = `query($org: String!, $slug: String!, $cursor: String) {
+  organization(login: $org) {
+    team(slug: $slug) {
+      members(first: 100, after: $cursor) {
+        totalCount
+        pageInfo { hasNextPage endCursor }
+        edges { role node { ` + gqlUserFields + ` } }
+      }
+    }
+  }
+}`
+
+const gqlTeamReposQuery = `query($org: String!, $slug: String!, $cursor: String) {
+  organization(login: $org) {
+    team(slug: $slug) {
+      repositories(first: 100, after: $cursor) {
+        totalCount
+        pageInfo { hasNextPage endCursor }
+        edges { permission node { ` + gqlRepoFields + ` } }
+      }
+    }
+  }
+}`
+
+// cursorVar returns the GraphQL value for a connection cursor, null on the first page
+func cursorVar(cursor string) interface{} {
+	if cursor == "" {
+		return nil
+	}
+	return cursor
+}
+
+// GraphQLMembers lists all members in org along with their org membership, using the GraphQL API.
+// It fills the same structures as AllMembers, GetAllUserDetails and GetAllMembership.
+func (c *Client) GraphQLMembers() ([]*User, []Membership, error) {
+	return c.GraphQLMembersContext(context.Background())
+}
+
+// GraphQLMembersContext is GraphQLMembers with a context controlling cancellation
+func (c *Client) GraphQLMembersContext(ctx context.Context) ([]*User, []Membership, error) {
+	var us []*User
+	var ms []Membership
+	var cursor string
+	for page := 1; ; page++ {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing Members via GraphQL, page %d\n", page)
+		var d struct {
+			Organization struct {
+				gqlOrganization
+				MembersWithRole struct {
+					PageInfo pageInfo `json:"pageInfo"`
+					Edges    []struct {
+						Role string  `json:"role"`
+						Node gqlUser `json:"node"`
+					} `json:"edges"`
+				} `json:"membersWithRole"`
+			} `json:"organization"`
+		}
+		vars := map[string]interface{}{
+			"org":    c.Org,
+			"cursor": cursorVar(cursor),
+		}
+		if err := c.GraphQLContext(ctx, gqlMembersQuery, vars, &d); err != nil {
+			return us, ms, err
+		}
+		org := c.organization(d.Organization.gqlOrganization)
+		for _, e := range d.Organization.MembersWithRole.Edges {
+			u := c.user(e.Node)
+			us = append(us, u)
+			ms = append(ms, Membership{
+				URL:             c.url("/orgs/" + c.Org + "/memberships/" + u.Login),
+				State:           "active",
+				Role:            strings.ToLower(e.Role),
+				OrganizationURL: org.URL,
+				Organization:    org,
+				User:            *u,
+			})
+		}
+		pi := d.Organization.MembersWithRole.PageInfo
+		if !pi.HasNextPage {
+			break
+		}
+		cursor = pi.EndCursor
+	}
+	return us, ms, nil
+}
+
+// GraphQLTeams lists all teams in org with their members and repositories, using the GraphQL API.
+// It fills the same structures as AllTeams and GetAllTeamDetails.
+func (c *Client) GraphQLTeams() ([]*Team, error) {
+	return c.GraphQLTeamsContext(context.Background())
+}
+
+// GraphQLTeamsContext is GraphQLTeams with a context controlling cancellation
+func (c *Client) GraphQLTeamsContext(ctx context.Context) ([]*Team, error) {
+	var ts []*Team
+	var cursor string
+	for page := 1; ; page++ {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing Teams via GraphQL, page %d\n", page)
+		var d struct {
+			Organization struct {
+				gqlOrganization
+				Teams struct {
+					PageInfo pageInfo  `json:"pageInfo"`
+					Nodes    []gqlTeam `json:"nodes"`
+				} `json:"teams"`
+			} `json:"organization"`
+		}
+		vars := map[string]interface{}{
+			"org":    c.Org,
+			"cursor": cursorVar(cursor),
+		}
+		if err := c.GraphQLContext(ctx, gqlTeamsQuery, vars, &d); err != nil {
+			return ts, err
+		}
+		org := c.organization(d.Organization.gqlOrganization)
+		for _, gt := range d.Organization.Teams.Nodes {
+			if err := c.graphQLTeamRemainder(ctx, &gt); err != nil {
+				return ts, err
+			}
+			ts = append(ts, c.team(gt, org))
+		}
+		pi := d.Organization.Teams.PageInfo
+		if !pi.HasNextPage {
+			break
+		}
+		cursor = pi.EndCursor
+	}
+	return ts, nil
+}
+
+// graphQLTeamRemainder fetches the members and repositories of gt beyond the first page
+func (c *Client) graphQLTeamRemainder(ctx context.Context, gt *gqlTeam) error {
+	for gt.Members.PageInfo.HasNextPage {
+		log.Printf("Listing Members in Team %s via GraphQL, %d of %d\n", gt.Name, len(gt.Members.Edges), gt.Members.TotalCount)
+		var d struct {
+			Organization struct {
+				Team struct {
+					Members gqlTeamMembers `json:"members"`
+				} `json:"team"`
+			} `json:"organization"`
+		}
+		vars := map[string]interface{}{
+			"org":    c.Org,
+			"slug":   gt.Slug,
+			"cursor": gt.Members.PageInfo.EndCursor,
+		}
+		if err := c.GraphQLContext(ctx, gqlTeamMembersQuery, vars, &d); err != nil {
+			return err
+		}
+		gt.Members.Edges = append(gt.Members.Edges, d.Organization.Team.Members.Edges...)
+		gt.Members.PageInfo = d.Organization.Team.Members.PageInfo
+	}
+	for gt.Repositories.PageInfo.HasNextPage {
+		log.Printf("Listing Team Repos for %s via GraphQL, %d of %d\n", gt.Name, len(gt.Repositories.Edges), gt.Repositories.TotalCount)
+		var d struct {
+			Organization struct {
+				Team struct {
+					Repositories gqlTeamRepos `json:"repositories"`
+				} `json:"team"`
+			} `json:"organization"`
+		}
+		vars := map[string]interface{}{
+			"org":    c.Org,
+			"slug":   gt.Slug,
+			"cursor": gt.Repositories.PageInfo.EndCursor,
+		}
+		if err := c.GraphQLContext(ctx, gqlTeamReposQuery, vars, &d); err != nil {
+			return err
+		}
+		gt.Repositories.Edges = append(gt.Repositories.Edges, d.Organization.Team.Repositories.Edges...)
+		gt.Repositories.PageInfo = d.Organization.Team.Repositories.PageInfo
+	}
+	return nil
+}
+
+// organization converts a GraphQL organization to its REST form
+func (c *Client) organization(o gqlOrganization) Organization {
+	return Organization{
+		Login:       o.Login,
+		ID:          o.DatabaseID,
+		NodeID:      o.ID,
+		URL:         c.url("/orgs/" + o.Login),
+		Description: o.Description,
+		Name:        o.Name,
+		Blog:        o.WebsiteURL,
+		Location:    o.Location,
+		Email:       o.Email,
+		HTMLURL:     o.URL,
+		CreatedAt:   o.CreatedAt,
+		Type:        "Organization",
+	}
+}
+
+// user converts a GraphQL user to its REST form
+func (c *Client) user(gu gqlUser) *User {
+	return &User{
+		Login:            gu.Login,
+		ID:               gu.DatabaseID,
+		NodeID:           gu.ID,
+		AvatarURL:        gu.AvatarURL,
+		URL:              c.url("/users/" + gu.Login),
+		HTMLURL:          gu.URL,
+		OrganizationsURL: c.url("/users/" + gu.Login + "/orgs"),
+		Type:             "User",
+		SiteAdmin:        gu.IsSiteAdmin,
+		Name:             gu.Name,
+		Company:          gu.Company,
+		Blog:             gu.WebsiteURL,
+		Location:         gu.Location,
+		Email:            gu.Email,
+		Hireable:         gu.IsHireable,
+		Bio:              gu.Bio,
+	}
+}
+
+// repository converts a GraphQL repository and a team's permission on it to its REST form
+func (c *Client) repository(gr gqlRepository, permission string) *Repository {
+	r := &Repository{
+		ID:            gr.DatabaseID,
+		NodeID:        gr.ID,
+		Name:          gr.Name,
+		FullName:      gr.NameWithOwner,
+		Owner:         User{Login: gr.Owner.Login},
+		Private:       gr.IsPrivate,
+		HTMLURL:       gr.URL,
+		Description:   gr.Description,
+		Fork:          gr.IsFork,
+		URL:           c.url("/repos/" + gr.NameWithOwner),
+		Homepage:      gr.HomepageURL,
+		Language:      gr.PrimaryLanguage.Name,
+		ForksCount:    gr.ForkCount,
+		Site:          gr.DiskUsage,
+		DefaultBranch: gr.DefaultBranchRef.Name,
+		IsTemplate:    gr.IsTemplate,
+		HasIssues:     gr.HasIssuesEnabled,
+		HasWiki:       gr.HasWikiEnabled,
+		Archived:      gr.IsArchived,
+		Disabled:      gr.IsDisabled,
+		PushedAt:      gr.PushedAt,
+		CreatedAt:     gr.CreatedAt,
+		UpdatedAt:     gr.UpdatedAt,
+	}
+	switch permission {
+	case "ADMIN":
+		r.Permissions = RepositoryPermissions{Admin: true, Maintain: true, Push: true, Triage: true, Pull: true}
+	case "MAINTAIN":
+		r.Permissions = RepositoryPermissions{Maintain: true, Push: true, Triage: true, Pull: true}
+	case "WRITE":
+		r.Permissions = RepositoryPermissions{Push: true, Triage: true, Pull: true}
+	case "TRIAGE":
+		r.Permissions = RepositoryPermissions{Triage: true, Pull: true}
+	case "READ":
+		r.Permissions = RepositoryPermissions{Pull: true}
+	}
+	return r
+}
+
+// teamPrivacy converts a GraphQL team privacy to its REST form
+func teamPrivacy(p string) string {
+	if p == "VISIBLE" {
+		return "closed"
+	}
+	return strings.ToLower(p)
+}
+
+// team converts a GraphQL team to its REST form
+func (c *Client) team(gt gqlTeam, org Organization) *Team {
+	turl := c.url("/teams/" + strconv.Itoa(gt.DatabaseID))
+	t := &Team{
+		ID:              gt.DatabaseID,
+		NodeID:          gt.ID,
+		URL:             turl,
+		Name:            gt.Name,
+		Slug:            gt.Slug,
+		Description:     gt.Description,
+		Privacy:         teamPrivacy(gt.Privacy),
+		MembersURL:      turl + "/members{/member}",
+		RepositoriesURL: turl + "/repos",
+		MembersCount:    gt.Members.TotalCount,
+		ReposCount:      gt.Repositories.TotalCount,
+		CreatedAt:       gt.CreatedAt,
+		UpdatedAt:       gt.UpdatedAt,
+		Organization:    org,
+	}
+	if gt.ParentTeam != nil {
+		purl := c.url("/teams/" + strconv.Itoa(gt.ParentTeam.DatabaseID))
+		t.Parent = ParentTeam{
+			ID:              gt.ParentTeam.DatabaseID,
+			NodeID:          gt.ParentTeam.ID,
+			URL:             purl,
+			Name:            gt.ParentTeam.Name,
+			Slug:            gt.ParentTeam.Slug,
+			Description:     gt.ParentTeam.Description,
+			Privacy:         teamPrivacy(gt.ParentTeam.Privacy),
+			MembersURL:      purl + "/members{/member}",
+			RepositoriesURL: purl + "/repos",
+		}
+	}
+	t.Roles = make(map[string]string)
+	for _, e := range gt.Members.Edges {
+		u := c.user(e.Node)
+		t.Members = append(t.Members, u)
+		t.Roles[strings.ToLower(u.Login)] = strings.ToLower(e.Role)
+	}
+	var rs []*Repository
+	for _, e := range gt.Repositories.Edges {
+		rs = append(rs, c.repository(e.Node, e.Permission))
+	}
+	t.SetRepositories(rs)
+	return t
+}
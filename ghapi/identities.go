@@ -0,0 +1,164 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+)
+
+// SSOIdentity links a GitHub user to their SAML identity
+type SSOIdentity struct {
+	// Login is empty if the identity is not yet linked to a GitHub account
+	Login  string `json:"login"`
+	GUID   string `json:"guid"`
+	NameID string `json:"name_id"`
+	Email  string `json:"email"`
+	// UPN is the SAML username, falling back to the NameID, which Azure AD sets to the UPN by default
+	UPN string `json:"upn"`
+}
+
+type gqlIdentityEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary"`
+}
+
+const gqlIdentitiesQuery = `query($org: String!, $cursor: String) {
+  organization(login: $org) {
+    samlIdentityProvider {
+      externalIdentities(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          guid
+          samlIdentity { nameId username emails { value primary } }
+          scimIdentity { username emails { value primary } }
+          user { login }
+        }
+      }
+    }
+  }
+}`
+
+// primaryEmail returns the primary email in es, or the first one if none is marked primary
+func primaryEmail(es []gqlIdentityEmail) string {
+	for _, e := range es {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(es) > 0 {
+		return es[0].Value
+	}
+	return ""
+}
+
+// GetSSOIdentities lists the SAML identities of the organization's identity provider
+func (c *Client) GetSSOIdentities() ([]*SSOIdentity, error) {
+	return c.GetSSOIdentitiesContext(context.Background())
+}
+
+// GetSSOIdentitiesContext is GetSSOIdentities with a context controlling cancellation
+func (c *Client) GetSSOIdentitiesContext(ctx context.Context) ([]*SSOIdentity, error) {
+	var ids []*SSOIdentity
+	var cursor string
+	for page := 1; ; page++ {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing SSO Identities, page %d\n", page)
+		var d struct {
+			Organization struct {
+				SAMLIdentityProvider *struct {
+					ExternalIdentities struct {
+						PageInfo pageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							GUID         string `json:"guid"`
+							SAMLIdentity *struct {
+								NameID   string             `json:"nameId"`
+								Username string             `json:"username"`
+								Emails   []gqlIdentityEmail `json:"emails"`
+							} `json:"samlIdentity"`
+							SCIMIdentity *struct {
+								Username string             `json:"username"`
+								Emails   []gqlIdentityEmail `json:"emails"`
+							} `json:"scimIdentity"`
+							User *struct {
+								Login string `json:"login"`
+							} `json:"user"`
+						} `json:"nodes"`
+					} `json:"externalIdentities"`
+				} `json:"samlIdentityProvider"`
+			} `json:"organization"`
+		}
+		vars := map[string]interface{}{
+			"org":    c.Org,
+			"cursor": cursorVar(cursor),
+		}
+		if err := c.GraphQLContext(ctx, gqlIdentitiesQuery, vars, &d); err != nil {
+			return ids, err
+		}
+		idp := d.Organization.SAMLIdentityProvider
+		if idp == nil {
+			return ids, errors.New("organization " + c.Org + " has no SAML identity provider")
+		}
+		for _, n := range idp.ExternalIdentities.Nodes {
+			id := &SSOIdentity{
+				GUID: n.GUID,
+			}
+			if n.User != nil {
+				id.Login = n.User.Login
+			}
+			if n.SAMLIdentity != nil {
+				id.NameID = n.SAMLIdentity.NameID
+				id.Email = primaryEmail(n.SAMLIdentity.Emails)
+				id.UPN = n.SAMLIdentity.Username
+			}
+			if n.SCIMIdentity != nil {
+				if id.Email == "" {
+					id.Email = primaryEmail(n.SCIMIdentity.Emails)
+				}
+				if id.UPN == "" {
+					id.UPN = n.SCIMIdentity.Username
+				}
+			}
+			if id.UPN == "" {
+				id.UPN = id.NameID
+			}
+			ids = append(ids, id)
+		}
+		pi := idp.ExternalIdentities.PageInfo
+		if !pi.HasNextPage {
+			break
+		}
+		cursor = pi.EndCursor
+	}
+	return ids, nil
+}
+
+// SaveSSOIdentities saves an SSO identity list to a JSON file
+func (c *Client) SaveSSOIdentities(ids []*SSOIdentity) error {
+	identityListFile := path.Join(c.DataDir, "sso_identities.json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Saving SSO identity list to: %s\n", identityListFile)
+	jd, jerr := json.Marshal(ids)
+	if jerr != nil {
+		return jerr
+	}
+	return writeDataFile(identityListFile, jd)
+}
+
+// LoadSSOIdentities loads the SSO identity list from the local data file
+func (c *Client) LoadSSOIdentities() ([]*SSOIdentity, error) {
+	identityListFile := path.Join(c.DataDir, "sso_identities.json")
+	var ids []*SSOIdentity
+	bd, rerr := ioutil.ReadFile(identityListFile)
+	if rerr != nil {
+		return ids, rerr
+	}
+	jerr := json.Unmarshal(bd, &ids)
+	if jerr != nil {
+		return ids, jerr
+	}
+	return ids, nil
+}
@@ -1,15 +1,17 @@
 package ghapi
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 )
 
+// Invitation contains org invitation data
 type Invitation struct {
 	ID                int    `json:"id"`
 	Login             string `json:"login"`
@@ -19,83 +21,113 @@ type Invitation struct {
 	Inviter           *User  `json:"inviter"`
 	TeamCount         int    `json:"team_count"`
 	InvitationTeamURL string `json:"invitation_team_url"`
+	// FailedAt and FailedReason are only set on failed invitations, including expired ones
+	FailedAt     string `json:"failed_at,omitempty"`
+	FailedReason string `json:"failed_reason,omitempty"`
 }
 
-// GetAllInvitations lists all repos for a team
-func GetAllInvitations() ([]*Invitation, error) {
-	var lp ListPages
+// Expired reports whether a failed invitation failed because it was not accepted in time
+func (i *Invitation) Expired() bool {
+	return strings.Contains(strings.ToLower(i.FailedReason), "expired")
+}
+
+// GetAllInvitations lists all pending invitations for org
+func (c *Client) GetAllInvitations() ([]*Invitation, error) {
+	return c.GetAllInvitationsContext(context.Background())
+}
+
+// GetAllInvitationsContext is GetAllInvitations with a context controlling cancellation
+func (c *Client) GetAllInvitationsContext(ctx context.Context) ([]*Invitation, error) {
 	var rs []*Invitation
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/orgs/"+c.Org+"/invitations", "application/vnd.github.dazzler-preview+json")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Org Invitations, %+v\n", lp)
-		isl, llp, err := ListInvitations(lp.Next)
-		rs = append(rs, isl...)
-		if err != nil {
+		log.Printf("Listing Org Invitations, page %d\n", pg.Page())
+		var isl []*Invitation
+		if err := pg.NextContext(ctx, &isl); err != nil {
 			return rs, err
 		}
-		if lp.Next == lp.Last && lp.Last > 0 {
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			break
-		}
+		rs = append(rs, isl...)
 	}
 	return rs, nil
 }
 
-// ListInvitations lists pending invitations for org
-func ListInvitations(page int) ([]*Invitation, ListPages, error) {
-	var il []*Invitation
-	var lp ListPages
-	reqURL := "https://api.github.com/orgs/" + Org + "/invitations"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
+// GetFailedInvitations lists all failed and expired invitations for org
+func (c *Client) GetFailedInvitations() ([]*Invitation, error) {
+	return c.GetFailedInvitationsContext(context.Background())
+}
+
+// GetFailedInvitationsContext is GetFailedInvitations with a context controlling cancellation
+func (c *Client) GetFailedInvitationsContext(ctx context.Context) ([]*Invitation, error) {
+	var rs []*Invitation
+	pg := c.NewPaginator("/orgs/"+c.Org+"/failed_invitations", "")
+	for pg.More() {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing Org Failed Invitations, page %d\n", pg.Page())
+		var isl []*Invitation
+		if err := pg.NextContext(ctx, &isl); err != nil {
+			return rs, err
+		}
+		rs = append(rs, isl...)
 	}
-	req, err := http.NewRequest("GET", reqURL, nil)
+	return rs, nil
+}
+
+// CancelInvitation cancels a pending org invitation
+func (c *Client) CancelInvitation(i *Invitation) error {
+	return c.CancelInvitationContext(context.Background(), i)
+}
+
+// CancelInvitationContext is CancelInvitation with a context controlling cancellation
+func (c *Client) CancelInvitationContext(ctx context.Context, i *Invitation) error {
+	req, err := c.newRequest(ctx, "DELETE", "/orgs/"+c.Org+"/invitations/"+strconv.Itoa(i.ID), nil)
 	if err != nil {
-		return il, lp, err
+		return err
 	}
-	req.Header.Set("Accept", "application/vnd.github.dazzler-preview+json")
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	log.SetOutput(os.Stdout)
+	log.Printf("Cancel invitation %d for: %s\n", i.ID, i.Login)
+	res, rerr := c.do(req)
 	if rerr != nil {
-		return il, lp, rerr
-	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
-	if err != nil {
-		return il, lp, err
-	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return il, lp, rlerr
+		return rerr
 	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
-		return il, lp, berr
+		return berr
 	}
-	jerr := json.Unmarshal(bd, &il)
-	if jerr != nil {
-		return il, lp, jerr
+	return checkResponse(res, bd)
+}
+
+// PendingInvitation returns the pending org invitation for a membership's user, or nil if there is none
+func (c *Client) PendingInvitation(m *Membership) (*Invitation, error) {
+	return c.PendingInvitationContext(context.Background(), m)
+}
+
+// PendingInvitationContext is PendingInvitation with a context controlling cancellation
+func (c *Client) PendingInvitationContext(ctx context.Context, m *Membership) (*Invitation, error) {
+	is, err := c.GetAllInvitationsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range is {
+		if i.Login != "" && strings.EqualFold(i.Login, m.User.Login) {
+			return i, nil
+		}
+		if i.Email != "" && strings.EqualFold(i.Email, m.User.Email) {
+			return i, nil
+		}
 	}
-	return il, lp, nil
+	return nil, nil
 }
 
 // SaveInvitations saves a membership list to a JSON file
-func SaveInvitations(ls []*Invitation) error {
-	invitationListFile := path.Join(DataDir, "invitations.json")
-	os.Remove(invitationListFile)
+func (c *Client) SaveInvitations(ls []*Invitation) error {
+	invitationListFile := path.Join(c.DataDir, "invitations.json")
 	log.SetOutput(os.Stdout)
 	log.Printf("Saving invitations list to: %s\n", invitationListFile)
 	jd, jerr := json.Marshal(ls)
 	if jerr != nil {
 		return jerr
 	}
-	return ioutil.WriteFile(invitationListFile, jd, 0755)
+	return writeDataFile(invitationListFile, jd)
 }
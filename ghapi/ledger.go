@@ -0,0 +1,194 @@
+package ghapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MigrationStep is a step of a user migration
+type MigrationStep string
+
+const (
+	// StepRemoved is the removal of the user from the org
+	StepRemoved MigrationStep = "removed"
+	// StepInvited is the re-invitation of the user to the org
+	StepInvited MigrationStep = "invited"
+	// StepAccepted is the user accepting the invitation
+	StepAccepted MigrationStep = "accepted"
+	// StepTeamsRestored is the restoration of the user's team memberships
+	StepTeamsRestored MigrationStep = "teams_restored"
+	// StepReposRestored is the restoration of the user's direct repository access
+	StepReposRestored MigrationStep = "repos_restored"
+)
+
+// MigrationSteps lists the steps of a user migration in order
+var MigrationSteps = []MigrationStep{StepRemoved, StepInvited, StepAccepted, StepTeamsRestored, StepReposRestored}
+
+// StepRecord records the outcome of a migration step
+type StepRecord struct {
+	Done bool `json:"done"`
+	// At is the time of the last attempt
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+}
+
+// MigrationRecord records the migration progress of a single user
+type MigrationRecord struct {
+	Login string                        `json:"login"`
+	Steps map[MigrationStep]*StepRecord `json:"steps"`
+}
+
+// StepDone reports whether step has completed
+func (r *MigrationRecord) StepDone(step MigrationStep) bool {
+	sr, ok := r.Steps[step]
+	return ok && sr.Done
+}
+
+// Done reports whether every migration step has completed
+func (r *MigrationRecord) Done() bool {
+	for _, s := range MigrationSteps {
+		if !r.StepDone(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ledger persists migration progress to migrations.json in the data directory,
+// so an interrupted or failed migration resumes where it stopped
+type Ledger struct {
+	Users map[string]*MigrationRecord `json:"users"`
+
+	file string
+	mu   sync.Mutex
+}
+
+// MigratedLogins lists the users recorded as migrated: those in migrated.csv in the
+// data directory, as written by scripts/migrate, followed by any other users
+// the ledger records as invited
+func (c *Client) MigratedLogins(l *Ledger) ([]string, error) {
+	var ls []string
+	seen := make(map[string]bool)
+	bd, rerr := ioutil.ReadFile(path.Join(c.DataDir, "migrated.csv"))
+	if rerr != nil && !os.IsNotExist(rerr) {
+		return ls, rerr
+	}
+	for _, line := range strings.Split(string(bd), "\n") {
+		login := strings.TrimSpace(strings.Split(line, ",")[0])
+		if login == "" || seen[strings.ToLower(login)] {
+			continue
+		}
+		seen[strings.ToLower(login)] = true
+		ls = append(ls, login)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var lls []string
+	for k, r := range l.Users {
+		if !seen[k] && r.StepDone(StepInvited) {
+			lls = append(lls, r.Login)
+		}
+	}
+	sort.Strings(lls)
+	return append(ls, lls...), nil
+}
+
+// LoadLedger loads the migration ledger, returning an empty ledger if none exists yet
+func (c *Client) LoadLedger() (*Ledger, error) {
+	l := &Ledger{
+		Users: make(map[string]*MigrationRecord),
+		file:  path.Join(c.DataDir, "migrations.json"),
+	}
+	bd, rerr := ioutil.ReadFile(l.file)
+	if os.IsNotExist(rerr) {
+		return l, nil
+	} else if rerr != nil {
+		return l, rerr
+	}
+	jerr := json.Unmarshal(bd, l)
+	if jerr != nil {
+		return l, jerr
+	}
+	if l.Users == nil {
+		l.Users = make(map[string]*MigrationRecord)
+	}
+	return l, nil
+}
+
+// Record returns a copy of the migration record for login
+func (l *Ledger) Record(login string) MigrationRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := MigrationRecord{
+		Login: login,
+		Steps: make(map[MigrationStep]*StepRecord),
+	}
+	if lr, ok := l.Users[strings.ToLower(login)]; ok {
+		for s, sr := range lr.Steps {
+			csr := *sr
+			r.Steps[s] = &csr
+		}
+	}
+	return r
+}
+
+// Complete marks step done for login and saves the ledger
+func (l *Ledger) Complete(login string, step MigrationStep) error {
+	return l.set(login, step, nil)
+}
+
+// Fail records that step failed for login with serr and saves the ledger.
+// It returns serr, or the error saving the ledger if that failed.
+func (l *Ledger) Fail(login string, step MigrationStep, serr error) error {
+	if err := l.set(login, step, serr); err != nil {
+		return err
+	}
+	return serr
+}
+
+// Reset forgets the migration progress of login and saves the ledger,
+// so a rolled back user can be migrated again
+func (l *Ledger) Reset(login string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.Users, strings.ToLower(login))
+	return l.save()
+}
+
+func (l *Ledger) set(login string, step MigrationStep, serr error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := strings.ToLower(login)
+	r, ok := l.Users[key]
+	if !ok {
+		r = &MigrationRecord{
+			Login: login,
+			Steps: make(map[MigrationStep]*StepRecord),
+		}
+		l.Users[key] = r
+	}
+	sr := &StepRecord{
+		Done: serr == nil,
+		At:   time.Now().UTC(),
+	}
+	if serr != nil {
+		sr.Error = serr.Error()
+	}
+	r.Steps[step] = sr
+	return l.save()
+}
+
+// save writes the ledger to disk. The caller must hold l.mu.
+func (l *Ledger) save() error {
+	jd, jerr := json.Marshal(l)
+	if jerr != nil {
+		return jerr
+	}
+	return writeDataFile(l.file, jd)
+}
@@ -0,0 +1,191 @@
+package ghapi
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// newLedger loads the ledger of a client with a new temporary data directory, removed by cleanup
+func newLedger(t *testing.T) (*Client, *Ledger, func()) {
+	dir, derr := ioutil.TempDir("", "ghapi")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	c := NewClient("o", "t", dir)
+	l, lerr := c.LoadLedger()
+	if lerr != nil {
+		os.RemoveAll(dir)
+		t.Fatal(lerr)
+	}
+	return c, l, func() { os.RemoveAll(dir) }
+}
+
+func TestLedgerResume(t *testing.T) {
+	_, l, cleanup := newLedger(t)
+	defer cleanup()
+	if r := l.Record("octocat"); len(r.Steps) != 0 || r.Done() {
+		t.Fatalf("Record() of new user = %+v, want no steps", r)
+	}
+	if err := l.Complete("octocat", StepRemoved); err != nil {
+		t.Fatal(err)
+	}
+	ierr := errors.New("422 Unprocessable Entity")
+	if err := l.Fail("octocat", StepInvited, ierr); err != ierr {
+		t.Fatalf("Fail() = %v, want the step error", err)
+	}
+	r := l.Record("octocat")
+	if !r.StepDone(StepRemoved) {
+		t.Error("removed step not done after it completed")
+	}
+	if r.StepDone(StepInvited) || r.Steps[StepInvited].Error != ierr.Error() {
+		t.Errorf("invited step = %+v, want failed with %q", r.Steps[StepInvited], ierr)
+	}
+	if r.Done() {
+		t.Error("Done() = true with a failed step")
+	}
+	// Resuming retries the failed step and carries on from there
+	for _, s := range MigrationSteps[1:] {
+		if err := l.Complete("octocat", s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r = l.Record("octocat")
+	if !r.Done() {
+		t.Errorf("Done() = false after every step completed: %+v", r.Steps)
+	}
+	if r.Steps[StepInvited].Error != "" {
+		t.Errorf("invited step error = %q after it completed, want none", r.Steps[StepInvited].Error)
+	}
+}
+
+func TestLedgerLoginCase(t *testing.T) {
+	_, l, cleanup := newLedger(t)
+	defer cleanup()
+	if err := l.Complete("OctoCat", StepRemoved); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Complete("octocat", StepInvited); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Users) != 1 {
+		t.Errorf("ledger has %d users, want 1", len(l.Users))
+	}
+	r := l.Record("OCTOCAT")
+	if !r.StepDone(StepRemoved) || !r.StepDone(StepInvited) {
+		t.Errorf("Record(OCTOCAT) steps = %+v, want removed and invited done", r.Steps)
+	}
+}
+
+func TestLedgerRecordCopy(t *testing.T) {
+	_, l, cleanup := newLedger(t)
+	defer cleanup()
+	if err := l.Complete("octocat", StepRemoved); err != nil {
+		t.Fatal(err)
+	}
+	r := l.Record("octocat")
+	r.Steps[StepRemoved].Done = false
+	r.Steps[StepInvited] = &StepRecord{Done: true}
+	if r := l.Record("octocat"); !r.StepDone(StepRemoved) || r.StepDone(StepInvited) {
+		t.Errorf("ledger changed through a copied record: %+v", r.Steps)
+	}
+}
+
+func TestLedgerPersistence(t *testing.T) {
+	c, l, cleanup := newLedger(t)
+	defer cleanup()
+	if err := l.Complete("octocat", StepRemoved); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Fail("octocat", StepInvited, errors.New("timeout")); err == nil {
+		t.Fatal("Fail() = nil, want the step error")
+	}
+	if err := l.Complete("Hubot", StepRemoved); err != nil {
+		t.Fatal(err)
+	}
+	ll, lerr := c.LoadLedger()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	if len(ll.Users) != 2 {
+		t.Fatalf("loaded ledger has %d users, want 2", len(ll.Users))
+	}
+	for _, login := range []string{"octocat", "Hubot"} {
+		want, got := l.Record(login), ll.Record(login)
+		if len(got.Steps) != len(want.Steps) {
+			t.Errorf("%s has %d steps after loading, want %d", login, len(got.Steps), len(want.Steps))
+		}
+		for s, sr := range want.Steps {
+			gsr, ok := got.Steps[s]
+			if !ok || gsr.Done != sr.Done || gsr.Error != sr.Error || !gsr.At.Equal(sr.At) {
+				t.Errorf("%s step %s = %+v after loading, want %+v", login, s, gsr, sr)
+			}
+		}
+	}
+	if ll.Users["hubot"].Login != "Hubot" {
+		t.Errorf("login = %q after loading, want Hubot", ll.Users["hubot"].Login)
+	}
+	// Steps recorded after loading are saved along with the loaded ones
+	if err := ll.Complete("octocat", StepInvited); err != nil {
+		t.Fatal(err)
+	}
+	l2, lerr := c.LoadLedger()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	if r := l2.Record("octocat"); !r.StepDone(StepRemoved) || !r.StepDone(StepInvited) {
+		t.Errorf("octocat steps = %+v after reloading, want removed and invited done", r.Steps)
+	}
+}
+
+func TestLedgerReset(t *testing.T) {
+	c, l, cleanup := newLedger(t)
+	defer cleanup()
+	for _, login := range []string{"OctoCat", "hubot"} {
+		if err := l.Complete(login, StepRemoved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Reset("octocat"); err != nil {
+		t.Fatal(err)
+	}
+	ll, lerr := c.LoadLedger()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	if r := ll.Record("octocat"); len(r.Steps) != 0 {
+		t.Errorf("octocat steps = %+v after reset, want none", r.Steps)
+	}
+	if r := ll.Record("hubot"); !r.StepDone(StepRemoved) {
+		t.Error("hubot lost their steps when octocat was reset")
+	}
+}
+
+func TestMigratedLogins(t *testing.T) {
+	c, l, cleanup := newLedger(t)
+	defer cleanup()
+	csv := "octocat,2020-01-02\nHubot,2020-01-02\n\nOCTOCAT,2020-01-03\n"
+	if werr := ioutil.WriteFile(path.Join(c.DataDir, "migrated.csv"), []byte(csv), 0644); werr != nil {
+		t.Fatal(werr)
+	}
+	for _, login := range []string{"zoe", "hubot", "amy"} {
+		if err := l.Complete(login, StepInvited); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Removed but not yet invited, so not migrated
+	if err := l.Complete("bob", StepRemoved); err != nil {
+		t.Fatal(err)
+	}
+	ls, err := c.MigratedLogins(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"octocat", "Hubot", "amy", "zoe"}
+	if !reflect.DeepEqual(ls, want) {
+		t.Errorf("MigratedLogins() = %v, want %v", ls, want)
+	}
+}
@@ -2,14 +2,12 @@ package ghapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
-	"strconv"
 )
 
 // User contains GitHub user data
@@ -33,112 +31,63 @@ type User struct {
 }
 
 // AllMembers lists all members in org
-func AllMembers() ([]*User, error) {
-	var lp ListPages
+func (c *Client) AllMembers() ([]*User, error) {
+	return c.AllMembersContext(context.Background())
+}
+
+// AllMembersContext is AllMembers with a context controlling cancellation
+func (c *Client) AllMembersContext(ctx context.Context) ([]*User, error) {
 	var us []*User
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/orgs/"+c.Org+"/members", "")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Members %+v\n", lp)
-		usl, llp, err := ListMembers(lp.Next)
-		if err != nil {
+		log.Printf("Listing Members, page %d\n", pg.Page())
+		var usl []*User
+		if err := pg.NextContext(ctx, &usl); err != nil {
 			return us, err
 		}
-		if lp.Next == lp.Last && lp.Last > 0 {
-			us = append(us, usl...)
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			us = append(us, usl...)
-			break
-		}
 		us = append(us, usl...)
 	}
 	return us, nil
 }
 
-// ListMembers lists members in an organization
-func ListMembers(page int) ([]*User, ListPages, error) {
-	var ul []*User
-	var lp ListPages
-	reqURL := "https://api.github.com/orgs/" + Org + "/members"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
-	}
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return ul, lp, err
-	}
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
-	if rerr != nil {
-		return ul, lp, rerr
-	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
-	if err != nil {
-		return ul, lp, err
-	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return ul, lp, rlerr
-	}
-	defer res.Body.Close()
-	bd, berr := ioutil.ReadAll(res.Body)
-	if berr != nil {
-		return ul, lp, berr
-	}
-	if res.StatusCode != 200 {
-		return ul, lp, errors.New(string(bd))
-	}
-	jerr := json.Unmarshal(bd, &ul)
-	if jerr != nil {
-		return ul, lp, jerr
-	}
-	return ul, lp, nil
-}
-
 // SaveMemberList saves a member list to a JSON file
-func SaveMemberList(ls []*User) error {
-	userListFile := path.Join(DataDir, "users.json")
-	os.Remove(userListFile)
+func (c *Client) SaveMemberList(ls []*User) error {
+	userListFile := path.Join(c.DataDir, "users.json")
 	log.SetOutput(os.Stdout)
 	log.Printf("Saving member list to: %s\n", userListFile)
 	jd, jerr := json.Marshal(ls)
 	if jerr != nil {
 		return jerr
 	}
-	return ioutil.WriteFile(userListFile, jd, 0755)
+	return writeDataFile(userListFile, jd)
 }
 
-// GetDetails gets memberships for all users
-func (u *User) GetDetails() error {
-	reqURL := "https://api.github.com/users/" + u.Login
-	req, err := http.NewRequest("GET", reqURL, nil)
+// GetUserDetails gets full details for a user
+func (c *Client) GetUserDetails(u *User) error {
+	return c.GetUserDetailsContext(context.Background(), u)
+}
+
+// GetUserDetailsContext is GetUserDetails with a context controlling cancellation
+func (c *Client) GetUserDetailsContext(ctx context.Context, u *User) error {
+	req, err := c.newRequest(ctx, "GET", "/users/"+u.Login, nil)
 	if err != nil {
 		return err
 	}
 	log.SetOutput(os.Stdout)
 	log.Printf("Get full details for user: %s\n", u.Login)
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return rerr
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rlerr
-	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
 		return berr
 	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return cerr
+	}
 	jerr := json.Unmarshal(bd, &u)
 	if jerr != nil {
 		return jerr
@@ -146,139 +95,228 @@ func (u *User) GetDetails() error {
 	return nil
 }
 
-// GetDetailsLocal gets the user details from the local data file
-func (u *User) GetDetailsLocal() (*User, error) {
-	userListFile := path.Join(DataDir, "users.json")
-	if _, cerr := os.Stat(userListFile); os.IsNotExist(cerr) {
-		log.Println(userListFile, "does not exist")
-		return u, cerr
+// AuthenticatedUser gets the user the client's token belongs to
+func (c *Client) AuthenticatedUser() (*User, error) {
+	return c.AuthenticatedUserContext(context.Background())
+}
+
+// AuthenticatedUserContext is AuthenticatedUser with a context controlling cancellation
+func (c *Client) AuthenticatedUserContext(ctx context.Context) (*User, error) {
+	u := new(User)
+	req, err := c.newRequest(ctx, "GET", "/user", nil)
+	if err != nil {
+		return u, err
 	}
-	var ul []*User
-	bd, rerr := ioutil.ReadFile(userListFile)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return u, rerr
 	}
-	jerr := json.Unmarshal(bd, &ul)
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return u, berr
+	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return u, cerr
+	}
+	jerr := json.Unmarshal(bd, u)
 	if jerr != nil {
 		return u, jerr
 	}
+	return u, nil
+}
+
+// GetAllUserDetails gets full details for every user in us
+func (c *Client) GetAllUserDetails(us []*User) error {
+	return c.GetAllUserDetailsContext(context.Background(), us)
+}
+
+// GetAllUserDetailsContext is GetAllUserDetails with a context controlling cancellation
+func (c *Client) GetAllUserDetailsContext(ctx context.Context, us []*User) error {
+	return c.forEach(ctx, len(us), func(ctx context.Context, i int) error {
+		return c.GetUserDetailsContext(ctx, us[i])
+	})
+}
+
+// LoadUsers loads the user list from the local data file
+func (c *Client) LoadUsers() ([]*User, error) {
+	if c.snapshot != nil {
+		return c.snapshot.Users, nil
+	}
+	var ul []*User
+	err := c.loadDataFile("users.json", &ul)
+	return ul, err
+}
+
+// GetUserDetailsLocal gets the user details from the local data file
+func (c *Client) GetUserDetailsLocal(u *User) (*User, error) {
+	ul, err := c.LoadUsers()
+	if err != nil {
+		return u, err
+	}
 	log.SetOutput(os.Stdout)
 	log.Printf("Get full local details for user: %s\n", u.Login)
 	for _, lu := range ul {
 		if lu.ID == u.ID {
-			u = lu
 			return lu, nil
 		}
 	}
 	return u, nil
 }
 
-// GetLocalMembership returns membership details for a user
-func (u *User) GetLocalMembership() (*Membership, error) {
-	m := new(Membership)
-	memberListFile := path.Join(DataDir, "memberships.json")
-	if _, cerr := os.Stat(memberListFile); os.IsNotExist(cerr) {
-		log.Println(memberListFile, "does not exist")
-		return m, cerr
+// localUsers maps the IDs of the users in the local data to their details
+func (c *Client) localUsers() (map[int]*User, error) {
+	ul, err := c.LoadUsers()
+	if err != nil {
+		return nil, err
 	}
-	var ms []*Membership
-	bd, rerr := ioutil.ReadFile(memberListFile)
-	if rerr != nil {
-		return m, rerr
+	lus := make(map[int]*User, len(ul))
+	for _, u := range ul {
+		lus[u.ID] = u
 	}
-	jerr := json.Unmarshal(bd, &ms)
-	if jerr != nil {
-		return m, jerr
+	return lus, nil
+}
+
+// GetLocalMembership returns membership details for a user
+func (c *Client) GetLocalMembership(u *User) (*Membership, error) {
+	m := new(Membership)
+	ms, err := c.LoadMemberships()
+	if err != nil {
+		return m, err
 	}
 	log.SetOutput(os.Stdout)
 	log.Printf("Get full membership details for user: %s\n", u.Login)
 	for _, lm := range ms {
 		if lm.User.Login == u.Login {
-			m = lm
+			// Return a copy, callers may change it
+			*m = *lm
 			return m, nil
 		}
 	}
 	return m, nil
 }
 
-// Remove removes member from org
-func (m *Membership) Remove() error {
-	reqURL := "https://api.github.com/orgs/" + Org + "/members/" + m.User.Login
-	req, err := http.NewRequest("DELETE", reqURL, nil)
+// RemoveMember removes member from org
+func (c *Client) RemoveMember(m *Membership) error {
+	return c.RemoveMemberContext(context.Background(), m)
+}
+
+// RemoveMemberContext is RemoveMember with a context controlling cancellation
+func (c *Client) RemoveMemberContext(ctx context.Context, m *Membership) error {
+	req, err := c.newRequest(ctx, "DELETE", "/orgs/"+c.Org+"/members/"+m.User.Login, nil)
 	if err != nil {
 		return err
 	}
 	log.SetOutput(os.Stdout)
-	log.Printf("Delete user from org %s: %s\n", Org, m.User.Login)
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	log.Printf("Delete user from org %s: %s\n", c.Org, m.User.Login)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return rerr
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rlerr
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
 	}
-	return nil
+	return checkResponse(res, bd)
+}
+
+// InviteMember invites user to org
+func (c *Client) InviteMember(m *Membership) error {
+	return c.InviteMemberContext(context.Background(), m)
 }
 
-// Invite invites user to org
-func (m *Membership) Invite() error {
-	reqURL := "https://api.github.com/orgs/" + Org + "/invitations"
-	type params struct {
-		InviteeID int    `json:"invitee_id,omitempty"`
-		Email     string `json:"email,omitempty"`
-		TeamIDs   []int  `json:"team_ids,omitempty"`
-		Role      string `json:"role"`
-	}
-	if m.Role == "" || m.Role == "member" {
-		m.Role = "direct_member"
-	}
-	p := &params{
+// InvitationRequest is the body of an org invitation
+type InvitationRequest struct {
+	InviteeID int    `json:"invitee_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	TeamIDs   []int  `json:"team_ids,omitempty"`
+	Role      string `json:"role"`
+}
+
+// NewInvitationRequest builds the invitation InviteMember sends for m, inviting
+// the user back with their org role to the teams in the local team list
+func (c *Client) NewInvitationRequest(m *Membership) (*InvitationRequest, error) {
+	p := &InvitationRequest{
 		Role: m.Role,
 	}
+	if p.Role == "" || p.Role == "member" {
+		p.Role = "direct_member"
+	}
 	if m.User.ID == 0 && m.User.Email != "" {
 		p.Email = m.User.Email
 	} else {
 		p.InviteeID = m.User.ID
 	}
 	var terr error
-	p.TeamIDs, terr = m.TeamIDs()
+	p.TeamIDs, terr = c.TeamIDs(m)
 	if terr != nil {
-		return terr
+		return p, terr
+	}
+	return p, nil
+}
+
+// InviteMemberContext is InviteMember with a context controlling cancellation
+func (c *Client) InviteMemberContext(ctx context.Context, m *Membership) error {
+	p, perr := c.NewInvitationRequest(m)
+	if perr != nil {
+		return perr
 	}
-	jd, jerr := json.Marshal(&p)
+	return c.SendInvitationContext(ctx, m, p)
+}
+
+// SendInvitation invites m's user to the org with invitation p. A request that
+// fails transiently is only retried if no invitation is pending for the user.
+func (c *Client) SendInvitation(m *Membership, p *InvitationRequest) error {
+	return c.SendInvitationContext(context.Background(), m, p)
+}
+
+// SendInvitationContext is SendInvitation with a context controlling cancellation
+func (c *Client) SendInvitationContext(ctx context.Context, m *Membership, p *InvitationRequest) error {
+	jd, jerr := json.Marshal(p)
 	if jerr != nil {
 		return jerr
 	}
-	req, err := http.NewRequest("POST", reqURL, bytes.NewBuffer(jd))
+	log.SetOutput(os.Stdout)
+	log.Printf("Invite user to org: %s\n", m.User.Login)
+	for attempt := 1; ; attempt++ {
+		ierr := c.postInvitation(ctx, jd)
+		if ierr == nil || !isTransient(ierr) || !c.Retry.retry(attempt) {
+			return ierr
+		}
+		// The invitation may have been created even though the response was lost,
+		// so only post again if it is not already pending
+		pi, perr := c.PendingInvitationContext(ctx, m)
+		if perr == nil && pi != nil {
+			log.Printf("Invitation for %s already pending after failed attempt\n", m.User.Login)
+			return nil
+		}
+		d := c.Retry.Backoff(attempt)
+		log.Printf("Invite user %s failed, attempt %d of %d, retrying in %s\n", m.User.Login, attempt, c.Retry.MaxAttempts, d)
+		if serr := sleep(ctx, d); serr != nil {
+			return serr
+		}
+	}
+}
+
+// postInvitation sends an org invitation request
+func (c *Client) postInvitation(ctx context.Context, jd []byte) error {
+	req, err := c.newRequest(ctx, "POST", "/orgs/"+c.Org+"/invitations", bytes.NewBuffer(jd))
 	if err != nil {
 		return err
 	}
-	log.SetOutput(os.Stdout)
-	log.Printf("Invite user to org: %s\n", m.User.Login)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "token "+Token)
 	req.Header.Set("Accept", "application/vnd.github.dazzler-preview+json")
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return rerr
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rlerr
-	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
 		return berr
 	}
-	if res.StatusCode > 202 {
-		return errors.New(string(bd))
-	}
-	return nil
+	return checkResponse(res, bd)
 }
 
 func (u *User) Repositories(repos []*Repository) ([]*Repository, error) {
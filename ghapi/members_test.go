@@ -0,0 +1,79 @@
+package ghapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient creates a client for the org o that sends its requests to srv
+func newTestClient(srv *httptest.Server) *Client {
+	c := NewClient("o", "t", "")
+	c.BaseURL = srv.URL
+	c.Transport = srv.Client().Transport
+	return c
+}
+
+func TestSendInvitationRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// pending is whether the invitation is listed after the failed post
+		pending   bool
+		wantPosts int
+	}{
+		{"created despite failure", true, 1},
+		{"not created", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/orgs/o/invitations" {
+					http.NotFound(w, r)
+					return
+				}
+				switch r.Method {
+				case "POST":
+					posts++
+					if posts == 1 {
+						// The gateway times out after the invitation is created, or before
+						w.WriteHeader(http.StatusBadGateway)
+						fmt.Fprint(w, `{"message":"Server Error"}`)
+						return
+					}
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{"id":1,"login":"octocat"}`)
+				case "GET":
+					if tt.pending && posts > 0 {
+						fmt.Fprint(w, `[{"id":1,"login":"octocat"}]`)
+						return
+					}
+					fmt.Fprint(w, `[]`)
+				}
+			}))
+			defer srv.Close()
+			c := newTestClient(srv)
+			c.Retry = RetryPolicy{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    time.Millisecond,
+			}
+			m := &Membership{
+				User: User{Login: "octocat", ID: 583231},
+				Role: "member",
+			}
+			p := &InvitationRequest{
+				InviteeID: m.User.ID,
+				Role:      "direct_member",
+			}
+			if err := c.SendInvitation(m, p); err != nil {
+				t.Fatal(err)
+			}
+			if posts != tt.wantPosts {
+				t.Errorf("invitation posted %d times, want %d", posts, tt.wantPosts)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package ghapi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
 )
@@ -39,29 +40,30 @@ type Organization struct {
 	Type        string `json:"type"`
 }
 
-// GetUserMembership lists members in an organization
-func (u *User) GetUserMembership() (Membership, error) {
+// GetUserMembership gets a user's membership in the organization
+func (c *Client) GetUserMembership(u *User) (Membership, error) {
+	return c.GetUserMembershipContext(context.Background(), u)
+}
+
+// GetUserMembershipContext is GetUserMembership with a context controlling cancellation
+func (c *Client) GetUserMembershipContext(ctx context.Context, u *User) (Membership, error) {
 	var ms Membership
-	reqURL := "https://api.github.com/orgs/" + Org + "/memberships/" + u.Login
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := c.newRequest(ctx, "GET", "/orgs/"+c.Org+"/memberships/"+u.Login, nil)
 	if err != nil {
 		return ms, err
 	}
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return ms, rerr
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return ms, rlerr
-	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
 		return ms, berr
 	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return ms, cerr
+	}
 	jerr := json.Unmarshal(bd, &ms)
 	if jerr != nil {
 		return ms, jerr
@@ -69,16 +71,56 @@ func (u *User) GetUserMembership() (Membership, error) {
 	return ms, nil
 }
 
+// SetMemberRole sets the org role of m's user to m.Role, admin or member.
+// A user who is not a member of the org is invited with that role.
+func (c *Client) SetMemberRole(m *Membership) error {
+	return c.SetMemberRoleContext(context.Background(), m)
+}
+
+// SetMemberRoleContext is SetMemberRole with a context controlling cancellation
+func (c *Client) SetMemberRoleContext(ctx context.Context, m *Membership) error {
+	type params struct {
+		Role string `json:"role"`
+	}
+	jd, jerr := json.Marshal(&params{
+		Role: m.Role,
+	})
+	if jerr != nil {
+		return jerr
+	}
+	req, err := c.newRequest(ctx, "PUT", "/orgs/"+c.Org+"/memberships/"+m.User.Login, bytes.NewBuffer(jd))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Set org role of %s to: %s\n", m.User.Login, m.Role)
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
+	}
+	return checkResponse(res, bd)
+}
+
 // GetAllMembership gets memberships for all users
-func GetAllMembership() ([]Membership, error) {
+func (c *Client) GetAllMembership() ([]Membership, error) {
+	return c.GetAllMembershipContext(context.Background())
+}
+
+// GetAllMembershipContext is GetAllMembership with a context controlling cancellation
+func (c *Client) GetAllMembershipContext(ctx context.Context) ([]Membership, error) {
 	var ms []Membership
-	var err error
 	log.SetOutput(os.Stdout)
-	if _, cerr := os.Stat(path.Join(DataDir, "users.json")); os.IsNotExist(cerr) {
-		log.Println(path.Join(DataDir, "users.json"), "does not exist")
+	if _, cerr := os.Stat(path.Join(c.DataDir, "users.json")); os.IsNotExist(cerr) {
+		log.Println(path.Join(c.DataDir, "users.json"), "does not exist")
 		return ms, cerr
 	}
-	ud, uerr := ioutil.ReadFile(path.Join(DataDir, "users.json"))
+	ud, uerr := ioutil.ReadFile(path.Join(c.DataDir, "users.json"))
 	if uerr != nil {
 		return ms, uerr
 	}
@@ -87,27 +129,47 @@ func GetAllMembership() ([]Membership, error) {
 	if jerr != nil {
 		return ms, jerr
 	}
+	return c.membershipsOf(ctx, us)
+}
+
+// membershipsOf gets the memberships of every user in us
+func (c *Client) membershipsOf(ctx context.Context, us []User) ([]Membership, error) {
+	log.SetOutput(os.Stdout)
 	log.Printf("Getting memberships for all %d members\n", len(us))
-	for _, u := range us {
-		log.Printf("Getting membership for user: %s", u.Login)
-		um, merr := u.GetUserMembership()
+	ms := make([]Membership, len(us))
+	err := c.forEach(ctx, len(us), func(ctx context.Context, i int) error {
+		log.Printf("Getting membership for user: %s", us[i].Login)
+		um, merr := c.GetUserMembershipContext(ctx, &us[i])
 		if merr != nil {
-			return ms, merr
+			return merr
 		}
-		ms = append(ms, um)
+		ms[i] = um
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return ms, err
+	return ms, nil
 }
 
 // SaveMembership saves a membership list to a JSON file
-func SaveMembership(ls []Membership) error {
-	memberListFile := path.Join(DataDir, "memberships.json")
-	os.Remove(memberListFile)
+func (c *Client) SaveMembership(ls []Membership) error {
+	memberListFile := path.Join(c.DataDir, "memberships.json")
 	log.SetOutput(os.Stdout)
 	log.Printf("Saving membership list to: %s\n", memberListFile)
 	jd, jerr := json.Marshal(ls)
 	if jerr != nil {
 		return jerr
 	}
-	return ioutil.WriteFile(memberListFile, jd, 0755)
+	return writeDataFile(memberListFile, jd)
+}
+
+// LoadMemberships loads the membership list from the local data file
+func (c *Client) LoadMemberships() ([]*Membership, error) {
+	if c.snapshot != nil {
+		return c.snapshot.Memberships, nil
+	}
+	var ms []*Membership
+	err := c.loadDataFile("memberships.json", &ms)
+	return ms, err
 }
@@ -2,8 +2,8 @@ package ghapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -12,7 +12,12 @@ import (
 )
 
 // OathToken generates an Oauth Token
-func OathToken(tf string) (OathResponse, error) {
+func (c *Client) OathToken(tf string) (OathResponse, error) {
+	return c.OathTokenContext(context.Background(), tf)
+}
+
+// OathTokenContext is OathToken with a context controlling cancellation
+func (c *Client) OathTokenContext(ctx context.Context, tf string) (OathResponse, error) {
 	var oar OathResponse
 	or := &oathReq{
 		//ClientID:     os.Getenv("OATH_CLIENT_ID"),
@@ -25,16 +30,15 @@ func OathToken(tf string) (OathResponse, error) {
 	if jerr != nil {
 		return oar, jerr
 	}
-	ourl := "https://api.github.com/authorizations/clients/" + os.Getenv("OATH_CLIENT_ID")
-	req, err := http.NewRequest("PUT", ourl, bytes.NewReader(jb))
+	ourl := c.url("/authorizations/clients/" + os.Getenv("OATH_CLIENT_ID"))
+	req, err := http.NewRequestWithContext(ctx, "PUT", ourl, bytes.NewReader(jb))
 	if err != nil {
 		return oar, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-GitHub-OTP", tf)
 	req.SetBasicAuth(os.Getenv("GITHUB_USERNAME"), os.Getenv("GITHUB_PASSWORD"))
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	res, rerr := c.httpClient().Do(req)
 	if rerr != nil {
 		return oar, rerr
 	}
@@ -43,8 +47,8 @@ func OathToken(tf string) (OathResponse, error) {
 	if berr != nil {
 		return oar, berr
 	}
-	if res.StatusCode != 200 {
-		return oar, errors.New(string(bd))
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return oar, cerr
 	}
 	fmt.Println(string(bd))
 	oerr := json.Unmarshal(bd, &oar)
@@ -1,95 +1,67 @@
 package ghapi
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
-	"strconv"
+	"strings"
 )
 
-// GetAllOutsideCollaborators lists all repos for a team
-func GetAllOutsideCollaborators() ([]*User, error) {
-	var lp ListPages
+// GetAllOutsideCollaborators lists all outside collaborators for org
+func (c *Client) GetAllOutsideCollaborators() ([]*User, error) {
+	return c.GetAllOutsideCollaboratorsContext(context.Background())
+}
+
+// GetAllOutsideCollaboratorsContext is GetAllOutsideCollaborators with a context controlling cancellation
+func (c *Client) GetAllOutsideCollaboratorsContext(ctx context.Context) ([]*User, error) {
 	var us []*User
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/orgs/"+c.Org+"/outside_collaborators", "")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Org Outside Collaborators, %+v\n", lp)
-		usl, llp, err := ListOutsideCollaborators(lp.Next)
+		log.Printf("Listing Org Outside Collaborators, page %d\n", pg.Page())
+		var usl []*User
+		if err := pg.NextContext(ctx, &usl); err != nil {
+			return us, err
+		}
 		for _, u := range usl {
-			gerr := u.GetDetails()
+			gerr := c.GetUserDetailsContext(ctx, u)
 			if gerr != nil {
 				return us, gerr
 			}
 		}
 		us = append(us, usl...)
-		if err != nil {
-			return us, err
-		}
-		if lp.Next == lp.Last && lp.Last > 0 {
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			break
-		}
 	}
 	return us, nil
 }
 
-// ListOutsideCollaborators lists outside collaborators for org
-func ListOutsideCollaborators(page int) ([]*User, ListPages, error) {
-	var ul []*User
-	var lp ListPages
-	reqURL := "https://api.github.com/orgs/" + Org + "/outside_collaborators"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
-	}
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return ul, lp, err
-	}
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
-	if rerr != nil {
-		return ul, lp, rerr
-	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
-	if err != nil {
-		return ul, lp, err
-	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return ul, lp, rlerr
-	}
-	defer res.Body.Close()
-	bd, berr := ioutil.ReadAll(res.Body)
-	if berr != nil {
-		return ul, lp, berr
-	}
-	jerr := json.Unmarshal(bd, &ul)
-	if jerr != nil {
-		return ul, lp, jerr
+// outsideCollaboratorLogins returns the set of lowercase logins of the org's outside collaborators
+func (c *Client) outsideCollaboratorLogins(ctx context.Context) (map[string]bool, error) {
+	ls := make(map[string]bool)
+	pg := c.NewPaginator("/orgs/"+c.Org+"/outside_collaborators", "")
+	for pg.More() {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing Org Outside Collaborators, page %d\n", pg.Page())
+		var usl []*User
+		if err := pg.NextContext(ctx, &usl); err != nil {
+			return ls, err
+		}
+		for _, u := range usl {
+			ls[strings.ToLower(u.Login)] = true
+		}
 	}
-	return ul, lp, nil
+	return ls, nil
 }
 
 // SaveOutsideCollaborators saves an outside collaborator list to a JSON file
-func SaveOutsideCollaborators(ls []*User) error {
-	collaboratorList := path.Join(DataDir, "outside_collaborators.json")
-	os.Remove(collaboratorList)
+func (c *Client) SaveOutsideCollaborators(ls []*User) error {
+	collaboratorList := path.Join(c.DataDir, "outside_collaborators.json")
 	log.SetOutput(os.Stdout)
 	log.Printf("Saving outside collaborator list to: %s\n", collaboratorList)
 	jd, jerr := json.Marshal(ls)
 	if jerr != nil {
 		return jerr
 	}
-	return ioutil.WriteFile(collaboratorList, jd, 0755)
+	return writeDataFile(collaboratorList, jd)
 }
@@ -0,0 +1,126 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPerPage is the page size requested from list endpoints
+const DefaultPerPage = 100
+
+// Paginator walks a list endpoint page by page, following the next URL of the Link header
+type Paginator struct {
+	c      *Client
+	next   string
+	accept string
+	page   int
+}
+
+// NewPaginator creates a paginator for the list endpoint at path p.
+// accept sets the Accept header for preview APIs and may be empty.
+func (c *Client) NewPaginator(p, accept string) *Paginator {
+	sep := "?"
+	if strings.Contains(p, "?") {
+		sep = "&"
+	}
+	return &Paginator{
+		c:      c,
+		next:   c.url(p) + sep + "per_page=" + strconv.Itoa(DefaultPerPage),
+		accept: accept,
+	}
+}
+
+// More reports whether there are pages left to fetch
+func (pg *Paginator) More() bool {
+	return pg.next != ""
+}
+
+// Page returns the number of the next page to fetch, starting at 1
+func (pg *Paginator) Page() int {
+	return pg.page + 1
+}
+
+// Next fetches the next page and decodes it into v, which must be a pointer to a slice.
+// An empty 204 response leaves v untouched and ends the pagination.
+func (pg *Paginator) Next(v interface{}) error {
+	return pg.NextContext(context.Background(), v)
+}
+
+// NextContext is Next with a context controlling cancellation
+func (pg *Paginator) NextContext(ctx context.Context, v interface{}) error {
+	if pg.next == "" {
+		return errors.New("no more pages")
+	}
+	req, err := pg.c.newRequestURL(ctx, "GET", pg.next, nil)
+	if err != nil {
+		return err
+	}
+	if pg.accept != "" {
+		req.Header.Set("Accept", pg.accept)
+	}
+	res, rerr := pg.c.do(req)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
+	}
+	pg.page++
+	pg.next = ""
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return cerr
+	}
+	next, nerr := pg.c.sameOrigin(nextLink(res.Header.Get("Link")))
+	if nerr != nil {
+		return nerr
+	}
+	pg.next = next
+	return json.Unmarshal(bd, v)
+}
+
+// sameOrigin checks that u points at the configured API host, so the token is never sent elsewhere
+func (c *Client) sameOrigin(u string) (string, error) {
+	if u == "" {
+		return u, nil
+	}
+	nu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	bu, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	if nu.Scheme != bu.Scheme || nu.Host != bu.Host {
+		return "", fmt.Errorf("next page %s is not on API host %s", u, bu.Host)
+	}
+	return u, nil
+}
+
+// nextLink returns the URL of the rel="next" entry of a Link header, or an empty string
+func nextLink(h string) string {
+	for _, l := range strings.Split(h, ",") {
+		parts := strings.Split(l, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, p := range parts[1:] {
+			if strings.TrimSpace(p) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package ghapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPaginatorFollowsNextLinks(t *testing.T) {
+	// 7 items served 3 per page over 3 pages, linking to the next and last pages
+	items := []int{1, 2, 3, 4, 5, 6, 7}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("per_page") != "100" {
+			t.Errorf("per_page = %q, want 100", r.URL.Query().Get("per_page"))
+		}
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		end := page * 3
+		if end >= len(items) {
+			end = len(items)
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?per_page=100&page=%d>; rel="next", <%s/items?per_page=100&page=3>; rel="last"`, srv.URL, page+1, srv.URL))
+		}
+		fmt.Fprint(w, strings.Join(strings.Fields(fmt.Sprint(items[(page-1)*3:end])), ","))
+	}))
+	defer srv.Close()
+	pg := newTestClient(srv).NewPaginator("/items", "")
+	var got []int
+	for pg.More() {
+		var pl []int
+		if err := pg.Next(&pl); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, pl...)
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("got %v, want %v", got, items)
+	}
+	if pg.Page() != 4 {
+		t.Errorf("fetched %d pages, want 3", pg.Page()-1)
+	}
+}
+
+func TestPaginatorAppendsPerPageToQuery(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, "[]")
+	}))
+	defer srv.Close()
+	pg := newTestClient(srv).NewPaginator("/teams/1/members?role=maintainer", "")
+	var us []*User
+	if err := pg.Next(&us); err != nil {
+		t.Fatal(err)
+	}
+	if query != "role=maintainer&per_page=100" {
+		t.Errorf("query = %q, want role=maintainer&per_page=100", query)
+	}
+}
+
+func TestPaginatorNoContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	pg := newTestClient(srv).NewPaginator("/orgs/o/repos", "")
+	v := []int{1}
+	if err := pg.Next(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []int{1}) {
+		t.Errorf("v = %v, want it untouched", v)
+	}
+	if pg.More() {
+		t.Error("More() = true after 204, want false")
+	}
+}
+
+func TestPaginatorRejectsOtherHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<https://evil.example.com/items?page=2>; rel="next"`)
+		fmt.Fprint(w, "[1]")
+	}))
+	defer srv.Close()
+	pg := newTestClient(srv).NewPaginator("/items", "")
+	var v []int
+	err := pg.Next(&v)
+	if err == nil || !strings.Contains(err.Error(), "not on API host") {
+		t.Errorf("err = %v, want not on API host error", err)
+	}
+	if pg.More() {
+		t.Error("More() = true after rejected next link, want false")
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"next first", `<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=2"},
+		{"next not first", `<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=3>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=3"},
+		{"last page", `<https://api.github.com/x?page=1>; rel="first", <https://api.github.com/x?page=4>; rel="prev"`, ""},
+		{"no rel", `<https://api.github.com/x?page=2>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextLink(tt.header); got != tt.want {
+				t.Errorf("nextLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
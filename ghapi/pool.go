@@ -0,0 +1,53 @@
+package ghapi
+
+import (
+	"context"
+	"sync"
+)
+
+// forEach calls fn for each index in [0, n) using up to c.Concurrency goroutines.
+// Callers keep output ordering deterministic by writing results to index i.
+// After the first error no further work is started and that error is returned.
+func (c *Client) forEach(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	workers := c.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idx := make(chan int)
+	var once sync.Once
+	var ferr error
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				if err := fn(ctx, i); err != nil {
+					once.Do(func() {
+						ferr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case idx <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(idx)
+	wg.Wait()
+	if ferr != nil {
+		return ferr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,196 @@
+package ghapi
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimitLowWater is the remaining request count at which requests block until the limit resets
+	DefaultRateLimitLowWater = 50
+	// secondaryRateLimitWait is the wait used when GitHub signals a secondary rate limit without a Retry-After
+	secondaryRateLimitWait = time.Minute
+	// maxRateLimitWaits bounds how many times a single request waits out a rate limit response
+	maxRateLimitWaits = 10
+	// CoreResource is the rate limit resource of REST requests
+	CoreResource = "core"
+	// GraphQLResource is the rate limit resource of GraphQL requests
+	GraphQLResource = "graphql"
+)
+
+// RateLimit contains the rate limit data
+type RateLimit struct {
+	// Resource is the budget the limit applies to, e.g. core for REST or graphql
+	Resource  string
+	Limit     int
+	Remaining int
+	// Reset is the Unix epoch, in seconds, at which the limit resets
+	Reset int
+}
+
+// ResetTime returns the time at which the limit resets
+func (rl *RateLimit) ResetTime() time.Time {
+	return time.Unix(int64(rl.Reset), 0)
+}
+
+// RateLimiter tracks the API rate limit of each resource and blocks requests when
+// their resource's limit is nearly exhausted. A RateLimiter may be shared by clients
+// using the same token.
+type RateLimiter struct {
+	// LowWater is the remaining request count at which requests block until the limit resets
+	LowWater int
+
+	mu          sync.Mutex
+	current     map[string]*RateLimit
+	pausedUntil time.Time
+}
+
+// NewRateLimiter creates a rate limiter that blocks once remaining requests reach lowWater
+func NewRateLimiter(lowWater int) *RateLimiter {
+	return &RateLimiter{
+		LowWater: lowWater,
+	}
+}
+
+// Current returns the most recently observed rate limit of resource, or nil if none has been seen
+func (l *RateLimiter) Current(resource string) *RateLimit {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current[resource] == nil {
+		return nil
+	}
+	rl := *l.current[resource]
+	return &rl
+}
+
+// Update records the rate limit returned with a response
+func (l *RateLimiter) Update(rl *RateLimit) {
+	if l == nil || rl == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil {
+		l.current = make(map[string]*RateLimit)
+	}
+	l.current[rl.Resource] = rl
+}
+
+// Pause blocks all requests for at least d
+func (l *RateLimiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Delay returns how long the next request against resource must wait
+func (l *RateLimiter) Delay(resource string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.pausedUntil.After(now) {
+		return l.pausedUntil.Sub(now)
+	}
+	if rl := l.current[resource]; rl != nil && rl.Remaining <= l.LowWater {
+		reset := rl.ResetTime()
+		if reset.After(now) {
+			return reset.Sub(now) + time.Second
+		}
+	}
+	return 0
+}
+
+// Wait sleeps until the next request against resource may be sent or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context, resource string) error {
+	d := l.Delay(resource)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	log.SetOutput(os.Stdout)
+	log.Printf("Rate Limit Reached for %s, sleeping for %s\n", resource, d.Round(time.Second))
+	return sleep(ctx, d)
+}
+
+// ParseRateLimit parses the rate limit from headers. The resource defaults to
+// core if the response does not name it.
+// A nil RateLimit is returned if the response carries no rate limit headers,
+// as is the case on GitHub Enterprise Server with rate limiting disabled.
+func ParseRateLimit(res *http.Response) (*RateLimit, error) {
+	var rl *RateLimit
+	if res.Header.Get("X-RateLimit-Limit") == "" {
+		return rl, nil
+	}
+	rlim, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return rl, err
+	}
+	rrem, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return rl, err
+	}
+	rres, err := strconv.Atoi(res.Header.Get("X-RateLimit-Reset"))
+	if err != nil {
+		return rl, err
+	}
+	rl = &RateLimit{
+		Resource:  res.Header.Get("X-RateLimit-Resource"),
+		Limit:     rlim,
+		Remaining: rrem,
+		Reset:     rres,
+	}
+	if rl.Resource == "" {
+		rl.Resource = CoreResource
+	}
+	return rl, nil
+}
+
+// rateLimitWait reports whether res was rejected by a primary or secondary
+// rate limit, and how long to wait before sending the request again
+func rateLimitWait(res *http.Response, rl *RateLimit) (time.Duration, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if ra := res.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if rl != nil && rl.Remaining == 0 {
+		return time.Until(rl.ResetTime()) + time.Second, true
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return secondaryRateLimitWait, true
+	}
+	// A 403 is only a rate limit if the message says so; peek at the body and put it back
+	bd, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(bd))
+	if err != nil {
+		return 0, false
+	}
+	msg := strings.ToLower(string(bd))
+	if strings.Contains(msg, "rate limit") || strings.Contains(msg, "abuse") {
+		return secondaryRateLimitWait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,172 @@
+package ghapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  map[string]string
+		want    *RateLimit
+		wantErr bool
+	}{
+		{"no headers", nil, nil, false},
+		{"all headers", map[string]string{
+			"X-RateLimit-Limit":     "5000",
+			"X-RateLimit-Remaining": "4999",
+			"X-RateLimit-Reset":     "1700000000",
+		}, &RateLimit{Resource: "core", Limit: 5000, Remaining: 4999, Reset: 1700000000}, false},
+		{"graphql resource", map[string]string{
+			"X-RateLimit-Limit":     "5000",
+			"X-RateLimit-Remaining": "4990",
+			"X-RateLimit-Reset":     "1700000000",
+			"X-RateLimit-Resource":  "graphql",
+		}, &RateLimit{Resource: "graphql", Limit: 5000, Remaining: 4990, Reset: 1700000000}, false},
+		{"missing remaining", map[string]string{
+			"X-RateLimit-Limit": "5000",
+			"X-RateLimit-Reset": "1700000000",
+		}, nil, true},
+		{"invalid reset", map[string]string{
+			"X-RateLimit-Limit":     "5000",
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     "soon",
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{Header: make(http.Header)}
+			for k, v := range tt.header {
+				res.Header.Set(k, v)
+			}
+			got, err := ParseRateLimit(res)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRateLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	reset := &RateLimit{Limit: 5000, Remaining: 0, Reset: int(time.Now().Add(30 * time.Second).Unix())}
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		rl         *RateLimit
+		min, max   time.Duration
+		limited    bool
+	}{
+		{"ok", http.StatusOK, "", "", nil, 0, 0, false},
+		{"not found", http.StatusNotFound, "", "rate limit", nil, 0, 0, false},
+		{"primary limit waits for reset", http.StatusForbidden, "", "", reset, 29 * time.Second, 31 * time.Second, true},
+		{"retry after wins over reset", http.StatusForbidden, "5", "", reset, 5 * time.Second, 5 * time.Second, true},
+		{"retry after on 429", http.StatusTooManyRequests, "7", "", nil, 7 * time.Second, 7 * time.Second, true},
+		{"429 without retry after", http.StatusTooManyRequests, "", "", nil, secondaryRateLimitWait, secondaryRateLimitWait, true},
+		{"secondary rate limit 403", http.StatusForbidden, "", `{"message":"You have exceeded a secondary rate limit"}`, nil, secondaryRateLimitWait, secondaryRateLimitWait, true},
+		{"abuse detection 403", http.StatusForbidden, "", `{"message":"You have triggered an abuse detection mechanism"}`, nil, secondaryRateLimitWait, secondaryRateLimitWait, true},
+		{"plain 403", http.StatusForbidden, "", `{"message":"Must have admin rights to Repository."}`, &RateLimit{Limit: 5000, Remaining: 4000}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: tt.status,
+				Header:     make(http.Header),
+				Body:       ioutil.NopCloser(strings.NewReader(tt.body)),
+			}
+			if tt.retryAfter != "" {
+				res.Header.Set("Retry-After", tt.retryAfter)
+			}
+			got, limited := rateLimitWait(res, tt.rl)
+			if limited != tt.limited {
+				t.Errorf("rateLimitWait() limited = %v, want %v", limited, tt.limited)
+			}
+			if got < tt.min || got > tt.max {
+				t.Errorf("rateLimitWait() = %s, want between %s and %s", got, tt.min, tt.max)
+			}
+			// The body is put back for the caller to read the error message
+			bd, _ := ioutil.ReadAll(res.Body)
+			if string(bd) != tt.body {
+				t.Errorf("body = %q, want %q", bd, tt.body)
+			}
+		})
+	}
+}
+
+func TestRateLimiterDelay(t *testing.T) {
+	l := NewRateLimiter(50)
+	if d := l.Delay(CoreResource); d != 0 {
+		t.Errorf("Delay() with no rate limit = %s, want 0", d)
+	}
+	reset := int(time.Now().Add(time.Minute).Unix())
+	l.Update(&RateLimit{Resource: CoreResource, Limit: 5000, Remaining: 51, Reset: reset})
+	if d := l.Delay(CoreResource); d != 0 {
+		t.Errorf("Delay() above low water = %s, want 0", d)
+	}
+	l.Update(&RateLimit{Resource: CoreResource, Limit: 5000, Remaining: 50, Reset: reset})
+	if d := l.Delay(CoreResource); d < 59*time.Second || d > 61*time.Second {
+		t.Errorf("Delay() at low water = %s, want about 1m", d)
+	}
+	// Another resource's budget is tracked separately
+	if d := l.Delay(GraphQLResource); d != 0 {
+		t.Errorf("Delay(graphql) with core at low water = %s, want 0", d)
+	}
+	l.Update(&RateLimit{Resource: GraphQLResource, Limit: 5000, Remaining: 4000, Reset: reset})
+	if d := l.Delay(CoreResource); d < 59*time.Second {
+		t.Errorf("Delay() after graphql update = %s, want about 1m", d)
+	}
+	l.Update(&RateLimit{Resource: CoreResource, Limit: 5000, Remaining: 50, Reset: int(time.Now().Add(-time.Minute).Unix())})
+	if d := l.Delay(CoreResource); d != 0 {
+		t.Errorf("Delay() after reset = %s, want 0", d)
+	}
+	l.Pause(10 * time.Second)
+	for _, r := range []string{CoreResource, GraphQLResource} {
+		if d := l.Delay(r); d <= 9*time.Second || d > 10*time.Second {
+			t.Errorf("Delay(%s) when paused = %s, want about 10s", r, d)
+		}
+	}
+}
+
+func TestClientRateLimitPerResource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		if r.URL.Path == "/graphql" {
+			w.Header().Set("X-RateLimit-Remaining", "4000")
+			w.Header().Set("X-RateLimit-Resource", "graphql")
+			fmt.Fprint(w, `{"data":{}}`)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "10")
+		w.Header().Set("X-RateLimit-Resource", "core")
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv)
+	c.RateLimiter = NewRateLimiter(0)
+	if _, err := c.AuthenticatedUser(); err != nil {
+		t.Fatal(err)
+	}
+	var v struct{}
+	if err := c.GraphQL("{viewer{login}}", nil, &v); err != nil {
+		t.Fatal(err)
+	}
+	if rl := c.RateLimit(); rl == nil || rl.Remaining != 10 {
+		t.Errorf("RateLimit() = %+v, want 10 remaining", rl)
+	}
+	if rl := c.RateLimiter.Current(GraphQLResource); rl == nil || rl.Remaining != 4000 {
+		t.Errorf("Current(graphql) = %+v, want 4000 remaining", rl)
+	}
+}
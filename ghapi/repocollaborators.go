@@ -0,0 +1,207 @@
+package ghapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// RepoCollaborator is a user with direct, rather than team, access to an org repository
+type RepoCollaborator struct {
+	// Repository is the name of the repository in the org
+	Repository string `json:"repository"`
+	Login      string `json:"login"`
+	ID         int    `json:"id"`
+	// Permission is pull, triage, push, maintain or admin
+	Permission string `json:"permission"`
+	// Outside is set for outside collaborators, who are not members of the org
+	Outside bool `json:"outside,omitempty"`
+}
+
+// RepoCollaborators lists the direct collaborators of repo r with their permission level
+func (c *Client) RepoCollaborators(r *Repository) ([]*RepoCollaborator, error) {
+	return c.RepoCollaboratorsContext(context.Background(), r)
+}
+
+// RepoCollaboratorsContext is RepoCollaborators with a context controlling cancellation
+func (c *Client) RepoCollaboratorsContext(ctx context.Context, r *Repository) ([]*RepoCollaborator, error) {
+	var rcs []*RepoCollaborator
+	pg := c.NewPaginator("/repos/"+c.Org+"/"+r.Name+"/collaborators?affiliation=direct", "")
+	for pg.More() {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing Collaborators for Repo %s, page %d\n", r.Name, pg.Page())
+		var csl []struct {
+			User
+			Permissions RepositoryPermissions `json:"permissions"`
+			RoleName    string                `json:"role_name"`
+		}
+		if err := pg.NextContext(ctx, &csl); err != nil {
+			return rcs, err
+		}
+		for _, cu := range csl {
+			rc := &RepoCollaborator{
+				Repository: r.Name,
+				Login:      cu.Login,
+				ID:         cu.ID,
+				Permission: permissionLevel(cu.Permissions, cu.RoleName),
+			}
+			rcs = append(rcs, rc)
+		}
+	}
+	return rcs, nil
+}
+
+// GetAllRepoCollaborators lists the direct collaborators of every repo in the org
+func (c *Client) GetAllRepoCollaborators() ([]*RepoCollaborator, error) {
+	return c.GetAllRepoCollaboratorsContext(context.Background())
+}
+
+// GetAllRepoCollaboratorsContext is GetAllRepoCollaborators with a context controlling cancellation
+func (c *Client) GetAllRepoCollaboratorsContext(ctx context.Context) ([]*RepoCollaborator, error) {
+	var rcs []*RepoCollaborator
+	rs, err := c.listOrgRepositories(ctx)
+	if err != nil {
+		return rcs, err
+	}
+	outside, oerr := c.outsideCollaboratorLogins(ctx)
+	if oerr != nil {
+		return rcs, oerr
+	}
+	rrcs := make([][]*RepoCollaborator, len(rs))
+	err = c.forEach(ctx, len(rs), func(ctx context.Context, i int) error {
+		var rerr error
+		rrcs[i], rerr = c.RepoCollaboratorsContext(ctx, rs[i])
+		return rerr
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range rrcs {
+		for _, rc := range l {
+			rc.Outside = outside[strings.ToLower(rc.Login)]
+		}
+		rcs = append(rcs, l...)
+	}
+	return rcs, nil
+}
+
+// SaveRepoCollaborators saves a repo collaborator list to a JSON file
+func (c *Client) SaveRepoCollaborators(rcs []*RepoCollaborator) error {
+	collaboratorList := path.Join(c.DataDir, "repo_collaborators.json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Saving repo collaborator list to: %s\n", collaboratorList)
+	jd, jerr := json.Marshal(rcs)
+	if jerr != nil {
+		return jerr
+	}
+	return writeDataFile(collaboratorList, jd)
+}
+
+// LoadRepoCollaborators loads the repo collaborator list from the local data file
+func (c *Client) LoadRepoCollaborators() ([]*RepoCollaborator, error) {
+	if c.snapshot != nil && c.snapshot.RepoCollaborators != nil {
+		return c.snapshot.RepoCollaborators, nil
+	}
+	var rcs []*RepoCollaborator
+	err := c.loadDataFile("repo_collaborators.json", &rcs)
+	return rcs, err
+}
+
+// OutsideRepoCollaborators returns the outside collaborators in the local repo collaborator list
+func (c *Client) OutsideRepoCollaborators() ([]*RepoCollaborator, error) {
+	var orcs []*RepoCollaborator
+	rcs, err := c.LoadRepoCollaborators()
+	if err != nil {
+		return orcs, err
+	}
+	for _, rc := range rcs {
+		if rc.Outside {
+			orcs = append(orcs, rc)
+		}
+	}
+	return orcs, nil
+}
+
+// UserRepoCollaborators returns the direct repo access of u in the local repo collaborator list
+func (c *Client) UserRepoCollaborators(u *User) ([]*RepoCollaborator, error) {
+	var urcs []*RepoCollaborator
+	rcs, err := c.LoadRepoCollaborators()
+	if err != nil {
+		return urcs, err
+	}
+	for _, rc := range rcs {
+		if (u.ID != 0 && rc.ID == u.ID) || strings.EqualFold(rc.Login, u.Login) {
+			urcs = append(urcs, rc)
+		}
+	}
+	return urcs, nil
+}
+
+// AddRepoCollaborator grants rc.Login rc.Permission on rc.Repository.
+// A user who is not an org member is sent a repository invitation.
+func (c *Client) AddRepoCollaborator(rc *RepoCollaborator) error {
+	return c.AddRepoCollaboratorContext(context.Background(), rc)
+}
+
+// AddRepoCollaboratorContext is AddRepoCollaborator with a context controlling cancellation
+func (c *Client) AddRepoCollaboratorContext(ctx context.Context, rc *RepoCollaborator) error {
+	type params struct {
+		Permission string `json:"permission"`
+	}
+	jd, jerr := json.Marshal(&params{
+		Permission: rc.Permission,
+	})
+	if jerr != nil {
+		return jerr
+	}
+	req, err := c.newRequest(ctx, "PUT", "/repos/"+c.Org+"/"+rc.Repository+"/collaborators/"+rc.Login, bytes.NewBuffer(jd))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Grant user %s %s on repo: %s\n", rc.Login, rc.Permission, rc.Repository)
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
+	}
+	return checkResponse(res, bd)
+}
+
+// RestoreRepoPermissions re-grants u its direct repo access in the local repo collaborator list.
+// Repos deleted since the pull are skipped.
+func (c *Client) RestoreRepoPermissions(u *User) error {
+	return c.RestoreRepoPermissionsContext(context.Background(), u)
+}
+
+// RestoreRepoPermissionsContext is RestoreRepoPermissions with a context controlling cancellation
+func (c *Client) RestoreRepoPermissionsContext(ctx context.Context, u *User) error {
+	rcs, err := c.UserRepoCollaborators(u)
+	if os.IsNotExist(err) {
+		log.Printf("No repo collaborators pulled, not restoring repo access for %s\n", u.Login)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, rc := range rcs {
+		arc := *rc
+		arc.Login = u.Login
+		aerr := c.AddRepoCollaboratorContext(ctx, &arc)
+		if IsNotFound(aerr) {
+			log.Printf("Repo %s no longer exists, skipping\n", rc.Repository)
+		} else if aerr != nil {
+			return aerr
+		}
+	}
+	return nil
+}
@@ -1,10 +1,10 @@
 package ghapi
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
 	"strconv"
@@ -43,6 +43,7 @@ type Repository struct {
 	CreatedAt        string                `json:"created_at"`
 	UpdatedAt        string                `json:"updated_at"`
 	Permissions      RepositoryPermissions `json:"permissions"`
+	RoleName         string                `json:"role_name,omitempty"`
 	SubscribersCount int                   `json:"subscribers_count"`
 	License          RepositoryLicense     `json:"license"`
 	Contributors     []*User               `json:"contributors"`
@@ -50,9 +51,43 @@ type Repository struct {
 
 // RepositoryPermissions contains permissions data for a repo
 type RepositoryPermissions struct {
-	Admin bool `json:"admin"`
-	Push  bool `json:"push"`
-	Pull  bool `json:"pull"`
+	Admin    bool `json:"admin"`
+	Maintain bool `json:"maintain"`
+	Push     bool `json:"push"`
+	Triage   bool `json:"triage"`
+	Pull     bool `json:"pull"`
+}
+
+// Level returns the highest permission granted: admin, maintain, push, triage or pull
+func (p RepositoryPermissions) Level() string {
+	switch {
+	case p.Admin:
+		return "admin"
+	case p.Maintain:
+		return "maintain"
+	case p.Push:
+		return "push"
+	case p.Triage:
+		return "triage"
+	case p.Pull:
+		return "pull"
+	}
+	return ""
+}
+
+// Permission returns the permission level in r.Permissions and r.RoleName,
+// which carries custom repository roles
+func (r *Repository) Permission() string {
+	return permissionLevel(r.Permissions, r.RoleName)
+}
+
+// permissionLevel returns roleName if it is a custom role, or else the level of p
+func permissionLevel(p RepositoryPermissions, roleName string) string {
+	switch roleName {
+	case "", "admin", "maintain", "write", "triage", "read":
+		return p.Level()
+	}
+	return roleName
 }
 
 // RepositoryLicense contains license information
@@ -65,227 +100,102 @@ type RepositoryLicense struct {
 }
 
 // TeamRepositories lists all repos for a team
-func (t *Team) TeamRepositories() ([]*Repository, error) {
-	var lp ListPages
+func (c *Client) TeamRepositories(t *Team) ([]*Repository, error) {
+	return c.TeamRepositoriesContext(context.Background(), t)
+}
+
+// TeamRepositoriesContext is TeamRepositories with a context controlling cancellation
+func (c *Client) TeamRepositoriesContext(ctx context.Context, t *Team) ([]*Repository, error) {
 	var rs []*Repository
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/teams/"+strconv.Itoa(t.ID)+"/repos", "application/vnd.github.hellcat-preview+json")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Team Repos for %s, %+v\n", t.Name, lp)
-		rsl, llp, err := t.ListRepositories(lp.Next)
-		rs = append(rs, rsl...)
-		if err != nil {
+		log.Printf("Listing Team Repos for %s, page %d\n", t.Name, pg.Page())
+		var rsl []*Repository
+		if err := pg.NextContext(ctx, &rsl); err != nil {
 			return rs, err
 		}
-		if lp.Next == lp.Last && lp.Last > 0 {
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			break
-		}
+		rs = append(rs, rsl...)
 	}
 	return rs, nil
 }
 
 // GetContributors lists all contributors for a repo
-func (r *Repository) GetContributors() ([]*User, error) {
-	var lp ListPages
+func (c *Client) GetContributors(r *Repository) ([]*User, error) {
+	return c.GetContributorsContext(context.Background(), r)
+}
+
+// GetContributorsContext is GetContributors with a context controlling cancellation
+func (c *Client) GetContributorsContext(ctx context.Context, r *Repository) ([]*User, error) {
 	var cs []*User
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/repos/"+c.Org+"/"+r.Name+"/contributors", "")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Contributors for Repo %s, %+v\n", r.Name, lp)
-		csl, llp, err := r.ListContributors(lp.Next)
-		cs = append(cs, csl...)
-		if err != nil {
+		log.Printf("Listing Contributors for Repo %s, page %d\n", r.Name, pg.Page())
+		var csl []*User
+		if err := pg.NextContext(ctx, &csl); err != nil {
 			return cs, err
 		}
-		if lp.Next == lp.Last && lp.Last > 0 {
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			break
-		}
+		cs = append(cs, csl...)
 	}
 	r.Contributors = cs
 	return cs, nil
 }
 
-// ListContributors lists contributors for a repo
-func (r *Repository) ListContributors(page int) ([]*User, ListPages, error) {
-	var rl []*User
-	var lp ListPages
-	reqURL := "https://api.github.com/repos/" + Org + "/" + r.Name + "/contributors"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
-	}
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return rl, lp, err
-	}
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
-	if rerr != nil {
-		return rl, lp, rerr
-	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
+// OrgRepositories lists all repos for an org
+func (c *Client) OrgRepositories() ([]*Repository, error) {
+	return c.OrgRepositoriesContext(context.Background())
+}
+
+// OrgRepositoriesContext is OrgRepositories with a context controlling cancellation
+func (c *Client) OrgRepositoriesContext(ctx context.Context) ([]*Repository, error) {
+	rs, err := c.listOrgRepositories(ctx)
 	if err != nil {
-		return rl, lp, err
-	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rl, lp, rlerr
-	}
-	defer res.Body.Close()
-	bd, berr := ioutil.ReadAll(res.Body)
-	if berr != nil {
-		return rl, lp, berr
-	}
-	if res.StatusCode != 200 {
-		return rl, lp, nil
-	}
-	jerr := json.Unmarshal(bd, &rl)
-	if jerr != nil {
-		return rl, lp, jerr
+		return rs, err
+	}
+	for _, r := range rs {
+		_, rerr := c.GetContributorsContext(ctx, r)
+		if IsForbidden(rerr) {
+			// GitHub refuses to list contributors for repos with very large histories
+			log.Printf("Contributors unavailable for repo %s: %s\n", r.Name, rerr)
+		} else if rerr != nil {
+			return rs, rerr
+		}
 	}
-	return rl, lp, nil
+	return rs, nil
 }
 
-// OrgRepositories lists all repos for a team
-func OrgRepositories() ([]*Repository, error) {
-	var lp ListPages
+// listOrgRepositories lists all repos for an org without their contributors
+func (c *Client) listOrgRepositories(ctx context.Context) ([]*Repository, error) {
 	var rs []*Repository
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/orgs/"+c.Org+"/repos", "application/vnd.github.baptiste-preview+json")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Repos for Org, %+v\n", lp)
-		rsl, llp, err := ListRepositories(lp.Next)
-		for _, r := range rsl {
-			_, rerr := r.GetContributors()
-			if rerr != nil {
-				return rs, rerr
-			}
-		}
-		rs = append(rs, rsl...)
-		if err != nil {
+		log.Printf("Listing Repos for Org, page %d\n", pg.Page())
+		var rsl []*Repository
+		if err := pg.NextContext(ctx, &rsl); err != nil {
 			return rs, err
 		}
-		if lp.Next == lp.Last && lp.Last > 0 {
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			break
-		}
+		rs = append(rs, rsl...)
 	}
 	return rs, nil
 }
 
-// ListRepositories lists repos for an org
-func ListRepositories(page int) ([]*Repository, ListPages, error) {
-	var rl []*Repository
-	var lp ListPages
-	reqURL := "https://api.github.com/orgs/" + Org + "/repos"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
-	}
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return rl, lp, err
-	}
-	req.Header.Set("Accept", "application/vnd.github.baptiste-preview+json")
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
-	if rerr != nil {
-		return rl, lp, rerr
-	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
-	if err != nil {
-		return rl, lp, err
-	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rl, lp, rlerr
-	}
-	defer res.Body.Close()
-	bd, berr := ioutil.ReadAll(res.Body)
-	if berr != nil {
-		return rl, lp, berr
-	}
-	jerr := json.Unmarshal(bd, &rl)
-	if jerr != nil {
-		return rl, lp, jerr
-	}
-	return rl, lp, nil
-}
-
-// ListRepositories lists repos for a team
-func (t *Team) ListRepositories(page int) ([]*Repository, ListPages, error) {
-	var rl []*Repository
-	var lp ListPages
-	reqURL := "https://api.github.com/teams/" + strconv.Itoa(t.ID) + "/repos"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
-	}
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return rl, lp, err
-	}
-	req.Header.Set("Accept", "application/vnd.github.hellcat-preview+json")
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
-	if rerr != nil {
-		return rl, lp, rerr
-	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
-	if err != nil {
-		return rl, lp, err
-	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rl, lp, rlerr
-	}
-	defer res.Body.Close()
-	bd, berr := ioutil.ReadAll(res.Body)
-	if berr != nil {
-		return rl, lp, berr
-	}
-	jerr := json.Unmarshal(bd, &rl)
-	if jerr != nil {
-		return rl, lp, jerr
-	}
-	return rl, lp, nil
-}
-
 // SaveTeamRepoList saves a repos list to a JSON file
-func SaveTeamRepoList(rs []*Repository) error {
-	teamRepoFile := path.Join(DataDir, "teamrepos.json")
-	os.Remove(teamRepoFile)
+func (c *Client) SaveTeamRepoList(rs []*Repository) error {
+	teamRepoFile := path.Join(c.DataDir, "teamrepos.json")
 	log.SetOutput(os.Stdout)
 	log.Printf("Saving team repo list to: %s\n", teamRepoFile)
 	jd, jerr := json.Marshal(rs)
 	if jerr != nil {
 		return jerr
 	}
-	return ioutil.WriteFile(teamRepoFile, jd, 0755)
+	return writeDataFile(teamRepoFile, jd)
 }
 
-func LoadRepositories() ([]*Repository, error) {
-	repoListFile := path.Join(DataDir, "repositories.json")
+// LoadRepositories loads the repo list from the local data file
+func (c *Client) LoadRepositories() ([]*Repository, error) {
+	repoListFile := path.Join(c.DataDir, "repositories.json")
 	var rs []*Repository
 	var err error
 	bd, rerr := ioutil.ReadFile(repoListFile)
@@ -300,14 +210,13 @@ func LoadRepositories() ([]*Repository, error) {
 }
 
 // SaveRepositories saves a repos list to a JSON file
-func SaveRepositories(rs []*Repository) error {
-	repoListFile := path.Join(DataDir, "repositories.json")
-	os.Remove(repoListFile)
+func (c *Client) SaveRepositories(rs []*Repository) error {
+	repoListFile := path.Join(c.DataDir, "repositories.json")
 	log.SetOutput(os.Stdout)
 	log.Printf("Saving repo list to: %s\n", repoListFile)
 	jd, jerr := json.Marshal(rs)
 	if jerr != nil {
 		return jerr
 	}
-	return ioutil.WriteFile(repoListFile, jd, 0755)
+	return writeDataFile(repoListFile, jd)
 }
@@ -0,0 +1,70 @@
+package ghapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryableStatus(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+		{http.StatusUnprocessableEntity, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+	}
+	for _, tt := range tests {
+		if got := retryableStatus(tt.code); got != tt.want {
+			t.Errorf("retryableStatus(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+	tests := []struct {
+		attempt int
+		// max is the delay before jitter, the backoff is between half of it and all of it
+		max time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{9, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := p.Backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("Backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+	if got := (RetryPolicy{}).Backoff(1); got != 0 {
+		t.Errorf("Backoff(1) with no delay = %s, want 0", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3}
+	for attempt, want := range map[int]bool{1: true, 2: true, 3: false, 4: false} {
+		if got := p.retry(attempt); got != want {
+			t.Errorf("retry(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
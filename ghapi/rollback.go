@@ -0,0 +1,168 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rollback outcomes
+const (
+	// RollbackRestored means the user's org role and team memberships were restored
+	RollbackRestored = "restored"
+	// RollbackInvited means the user was re-invited and teams are restored by rolling back again once they accept
+	RollbackInvited = "invited"
+	// RollbackFailed means a request failed, rolling back again retries it
+	RollbackFailed = "failed"
+	// RollbackUnrestorable means the user's state cannot be restored, e.g. the account was deleted
+	RollbackUnrestorable = "unrestorable"
+)
+
+// TeamRollback records the restoration of a team membership
+type TeamRollback struct {
+	Slug  string `json:"slug"`
+	Role  string `json:"role"`
+	Error string `json:"error,omitempty"`
+}
+
+// RollbackResult records the outcome of rolling back a user
+type RollbackResult struct {
+	Login   string          `json:"login"`
+	Status  string          `json:"status"`
+	OrgRole string          `json:"org_role,omitempty"`
+	Teams   []*TeamRollback `json:"teams,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	At      time.Time       `json:"at"`
+}
+
+func (r *RollbackResult) fail(status string, err error) *RollbackResult {
+	r.Status = status
+	r.Error = err.Error()
+	return r
+}
+
+// RollbackUser restores u to its org role and team memberships in the local
+// membership and team lists, the snapshot taken before migration. A user who is
+// no longer a member is re-invited with their original role, unless an invitation
+// is already pending; rolling back again once they accept restores their team roles.
+func (c *Client) RollbackUser(u *User) *RollbackResult {
+	return c.RollbackUserContext(context.Background(), u)
+}
+
+// RollbackUserContext is RollbackUser with a context controlling cancellation
+func (c *Client) RollbackUserContext(ctx context.Context, u *User) *RollbackResult {
+	r := &RollbackResult{
+		Login: u.Login,
+		At:    time.Now().UTC(),
+	}
+	m, err := c.GetLocalMembership(u)
+	if err != nil {
+		return r.fail(RollbackFailed, err)
+	}
+	if m.URL == "" {
+		return r.fail(RollbackUnrestorable, fmt.Errorf("%s is not a member in memberships.json", u.Login))
+	}
+	r.OrgRole = m.Role
+	cu := User{
+		Login: m.User.Login,
+	}
+	if uerr := c.GetUserDetailsContext(ctx, &cu); IsNotFound(uerr) {
+		return r.fail(RollbackUnrestorable, fmt.Errorf("account %s not found", m.User.Login))
+	} else if uerr != nil {
+		return r.fail(RollbackFailed, uerr)
+	}
+	if m.User.ID != 0 && cu.ID != m.User.ID {
+		return r.fail(RollbackUnrestorable, fmt.Errorf("login %s now belongs to a different account", m.User.Login))
+	}
+	cm, merr := c.GetUserMembershipContext(ctx, &m.User)
+	if merr != nil && !IsNotFound(merr) {
+		return r.fail(RollbackFailed, merr)
+	}
+	if cm.State != "active" {
+		// A pending membership is an invitation not yet accepted, sending another would fail
+		if cm.State == "pending" {
+			log.SetOutput(os.Stdout)
+			log.Printf("Invitation already pending for %s\n", m.User.Login)
+		} else if ierr := c.InviteMemberContext(ctx, m); ierr != nil {
+			return r.fail(RollbackFailed, ierr)
+		}
+		r.Status = RollbackInvited
+		return r
+	}
+	if cm.Role != m.Role {
+		if serr := c.SetMemberRoleContext(ctx, m); serr != nil {
+			return r.fail(RollbackFailed, serr)
+		}
+	}
+	ts, terr := c.UserTeams(&m.User)
+	if terr != nil {
+		return r.fail(RollbackFailed, terr)
+	}
+	r.Status = RollbackRestored
+	for _, t := range ts {
+		tr := &TeamRollback{
+			Slug: t.Slug,
+			Role: t.MemberRole(&m.User),
+		}
+		if ierr := c.InviteMemberToTeamContext(ctx, m, t); ierr != nil {
+			tr.Error = ierr.Error()
+			r.Status = RollbackFailed
+			r.Error = "team " + t.Slug + ": " + ierr.Error()
+		}
+		r.Teams = append(r.Teams, tr)
+	}
+	return r
+}
+
+// LoadRollbackResults loads rollback results from the local data file, keyed by lowercase login
+func (c *Client) LoadRollbackResults() (map[string]*RollbackResult, error) {
+	rs := make(map[string]*RollbackResult)
+	bd, rerr := ioutil.ReadFile(path.Join(c.DataDir, "rollback.json"))
+	if os.IsNotExist(rerr) {
+		return rs, nil
+	} else if rerr != nil {
+		return rs, rerr
+	}
+	var rl []*RollbackResult
+	if jerr := json.Unmarshal(bd, &rl); jerr != nil {
+		return rs, jerr
+	}
+	for _, r := range rl {
+		rs[strings.ToLower(r.Login)] = r
+	}
+	return rs, nil
+}
+
+// SaveRollbackResults merges rl into rollback.json in the data directory,
+// replacing earlier results for the same users
+func (c *Client) SaveRollbackResults(rl []*RollbackResult) error {
+	rs, lerr := c.LoadRollbackResults()
+	if lerr != nil {
+		return lerr
+	}
+	var all []*RollbackResult
+	for _, r := range rl {
+		rs[strings.ToLower(r.Login)] = r
+	}
+	for _, r := range rs {
+		all = append(all, r)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.ToLower(all[i].Login) < strings.ToLower(all[j].Login)
+	})
+	rollbackFile := path.Join(c.DataDir, "rollback.json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Saving rollback results to: %s\n", rollbackFile)
+	jd, jerr := json.Marshal(all)
+	if jerr != nil {
+		return jerr
+	}
+	return writeDataFile(rollbackFile, jd)
+}
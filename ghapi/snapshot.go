@@ -0,0 +1,192 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+)
+
+// Snapshot is the pulled org data held in memory
+type Snapshot struct {
+	Users       []*User
+	Memberships []*Membership
+	Teams       []*Team
+	// RepoCollaborators is nil if repo collaborators have not been pulled
+	RepoCollaborators []*RepoCollaborator
+}
+
+// LoadSnapshot reads users.json, memberships.json, teams.json and, if pulled,
+// repo_collaborators.json once and serves subsequent local lookups from memory,
+// so batch operations do not re-read the data files for every user. Pulling
+// afresh does not update a loaded snapshot.
+func (c *Client) LoadSnapshot() (*Snapshot, error) {
+	s := new(Snapshot)
+	var err error
+	c.snapshot = nil
+	if s.Users, err = c.LoadUsers(); err != nil {
+		return s, err
+	}
+	if s.Memberships, err = c.LoadMemberships(); err != nil {
+		return s, err
+	}
+	if s.Teams, err = c.LoadTeams(); err != nil {
+		return s, err
+	}
+	if s.RepoCollaborators, err = c.LoadRepoCollaborators(); err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	c.snapshot = s
+	return s, nil
+}
+
+// PullSnapshot pulls the org's users, memberships and teams into memory, with the
+// GraphQL API if graphql is set, without writing the data files. Subsequent local
+// lookups are served from the pulled snapshot, as after LoadSnapshot.
+func (c *Client) PullSnapshot(graphql bool) (*Snapshot, error) {
+	return c.PullSnapshotContext(context.Background(), graphql)
+}
+
+// PullSnapshotContext is PullSnapshot with a context controlling cancellation
+func (c *Client) PullSnapshotContext(ctx context.Context, graphql bool) (*Snapshot, error) {
+	s := new(Snapshot)
+	c.snapshot = nil
+	if graphql {
+		us, ms, err := c.GraphQLMembersContext(ctx)
+		if err != nil {
+			return s, err
+		}
+		s.Users = us
+		for i := range ms {
+			s.Memberships = append(s.Memberships, &ms[i])
+		}
+		if s.Teams, err = c.GraphQLTeamsContext(ctx); err != nil {
+			return s, err
+		}
+		c.snapshot = s
+		return s, nil
+	}
+	us, err := c.AllMembersContext(ctx)
+	if err != nil {
+		return s, err
+	}
+	if err = c.GetAllUserDetailsContext(ctx, us); err != nil {
+		return s, err
+	}
+	s.Users = us
+	uvs := make([]User, len(us))
+	for i, u := range us {
+		uvs[i] = *u
+	}
+	ms, err := c.membershipsOf(ctx, uvs)
+	if err != nil {
+		return s, err
+	}
+	for i := range ms {
+		s.Memberships = append(s.Memberships, &ms[i])
+	}
+	ts, err := c.AllTeamsContext(ctx)
+	if err != nil {
+		return s, err
+	}
+	// Team members are looked up in the pulled users rather than users.json
+	c.snapshot = s
+	if err = c.GetAllTeamDetailsContext(ctx, ts); err != nil {
+		c.snapshot = nil
+		return s, err
+	}
+	s.Teams = ts
+	return s, nil
+}
+
+// preMigrationDir is the directory in the data directory holding the data files
+// as they were before the first migration
+const preMigrationDir = "premigration"
+
+// preMigrationFiles are the data files rollback restores users from
+var preMigrationFiles = []string{"users.json", "memberships.json", "teams.json"}
+
+// SavePreMigrationSnapshot copies users.json, memberships.json and teams.json
+// into the premigration directory of the data directory, unless a copy already
+// exists, so that pulling again after migrating does not overwrite the state
+// users are rolled back to.
+func (c *Client) SavePreMigrationSnapshot() error {
+	dir := path.Join(c.DataDir, preMigrationDir)
+	if _, serr := os.Stat(dir); serr == nil || !os.IsNotExist(serr) {
+		return serr
+	}
+	// Copy into a temporary directory so an interrupted copy is not taken for a snapshot
+	tmp := dir + ".tmp"
+	if rerr := os.RemoveAll(tmp); rerr != nil {
+		return rerr
+	}
+	if merr := os.MkdirAll(tmp, 0755); merr != nil {
+		return merr
+	}
+	for _, f := range preMigrationFiles {
+		bd, rerr := ioutil.ReadFile(path.Join(c.DataDir, f))
+		if rerr != nil {
+			os.RemoveAll(tmp)
+			return rerr
+		}
+		if werr := ioutil.WriteFile(path.Join(tmp, f), bd, 0755); werr != nil {
+			os.RemoveAll(tmp)
+			return werr
+		}
+	}
+	log.SetOutput(os.Stdout)
+	log.Printf("Saving pre-migration snapshot to: %s\n", dir)
+	return os.Rename(tmp, dir)
+}
+
+// LoadPreMigrationSnapshot is LoadSnapshot reading the copy saved by
+// SavePreMigrationSnapshot. The current data files are read if there is no copy,
+// as is the case for data directories migrated from before copies were saved.
+func (c *Client) LoadPreMigrationSnapshot() (*Snapshot, error) {
+	if _, serr := os.Stat(path.Join(c.DataDir, preMigrationDir)); os.IsNotExist(serr) {
+		log.SetOutput(os.Stdout)
+		log.Println("No pre-migration snapshot, using the pulled data")
+		return c.LoadSnapshot()
+	} else if serr != nil {
+		return nil, serr
+	}
+	s := new(Snapshot)
+	c.snapshot = nil
+	if err := c.loadDataFile(path.Join(preMigrationDir, "users.json"), &s.Users); err != nil {
+		return s, err
+	}
+	if err := c.loadDataFile(path.Join(preMigrationDir, "memberships.json"), &s.Memberships); err != nil {
+		return s, err
+	}
+	if err := c.loadDataFile(path.Join(preMigrationDir, "teams.json"), &s.Teams); err != nil {
+		return s, err
+	}
+	c.snapshot = s
+	return s, nil
+}
+
+// Team returns the team with slug, or nil if there is none
+func (s *Snapshot) Team(slug string) *Team {
+	for _, t := range s.Teams {
+		if t.Slug == slug {
+			return t
+		}
+	}
+	return nil
+}
+
+// loadDataFile decodes the JSON data file name in the data directory into v
+func (c *Client) loadDataFile(name string, v interface{}) error {
+	f := path.Join(c.DataDir, name)
+	if _, cerr := os.Stat(f); os.IsNotExist(cerr) {
+		log.Println(f, "does not exist")
+		return cerr
+	}
+	bd, rerr := ioutil.ReadFile(f)
+	if rerr != nil {
+		return rerr
+	}
+	return json.Unmarshal(bd, v)
+}
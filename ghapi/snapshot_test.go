@@ -0,0 +1,72 @@
+package ghapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// writeData writes the data files users.json, memberships.json and teams.json into dir
+// with login as the only member and slug as the only team
+func writeData(t *testing.T, dir, login, slug string) {
+	files := map[string]string{
+		"users.json":       `[{"login":"` + login + `","id":1}]`,
+		"memberships.json": `[{"url":"u","role":"admin","user":{"login":"` + login + `","id":1}}]`,
+		"teams.json":       `[{"slug":"` + slug + `","id":1}]`,
+	}
+	for f, d := range files {
+		if err := ioutil.WriteFile(path.Join(dir, f), []byte(d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPreMigrationSnapshot(t *testing.T) {
+	dir, derr := ioutil.TempDir("", "ghapi")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	c := NewClient("o", "t", dir)
+	writeData(t, dir, "before", "old-team")
+
+	// Without a copy the pulled data is used
+	s, err := c.LoadPreMigrationSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Memberships) != 1 || s.Memberships[0].User.Login != "before" {
+		t.Fatalf("LoadPreMigrationSnapshot() without a copy = %+v, want the pulled memberships", s.Memberships)
+	}
+
+	if err := c.SavePreMigrationSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	// A later pull changes the data files, and a later migration does not replace the copy
+	writeData(t, dir, "after", "new-team")
+	if err := c.SavePreMigrationSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dir, preMigrationDir+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary copy left behind: %v", err)
+	}
+
+	s, err = c.LoadPreMigrationSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Users) != 1 || s.Users[0].Login != "before" {
+		t.Errorf("Users = %+v, want the pre-migration user", s.Users)
+	}
+	if len(s.Memberships) != 1 || s.Memberships[0].User.Login != "before" || s.Memberships[0].Role != "admin" {
+		t.Errorf("Memberships = %+v, want the pre-migration membership", s.Memberships)
+	}
+	if s.Team("old-team") == nil || s.Team("new-team") != nil {
+		t.Errorf("Teams = %+v, want the pre-migration team", s.Teams)
+	}
+	// Local lookups are served from the copy
+	if m, err := c.GetLocalMembership(&User{Login: "before"}); err != nil || m.URL == "" {
+		t.Errorf("GetLocalMembership() = %+v, %v, want the pre-migration membership", m, err)
+	}
+}
@@ -0,0 +1,181 @@
+package ghapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DesiredState is the desired org membership, teams and team repository permissions,
+// as read from a JSON file by LoadDesiredState
+type DesiredState struct {
+	// Members lists every member of the org. If omitted, org membership is left as it is.
+	Members []*DesiredMember `json:"members"`
+	// Teams lists the teams to manage. Teams not listed are left as they are.
+	Teams []*DesiredTeam `json:"teams"`
+}
+
+// DesiredMember is an org member with their org role, admin or member
+type DesiredMember struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+}
+
+// DesiredTeam is a team with its members and its permissions on repositories
+type DesiredTeam struct {
+	Slug string `json:"slug"`
+	// Name, Description and Privacy are only used to create a team that does not exist
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Privacy     string `json:"privacy"`
+	// Maintainers and Members list the team's members by team role.
+	// If both are omitted, the team's members are left as they are.
+	Maintainers []string `json:"maintainers"`
+	Members     []string `json:"members"`
+	// Repos maps repository names to the team's permission on them.
+	// If omitted, the team's repositories are left as they are.
+	Repos map[string]string `json:"repos"`
+}
+
+// ManagesMembers reports whether the state lists the org's members
+func (s *DesiredState) ManagesMembers() bool {
+	return s.Members != nil
+}
+
+// Member returns the desired member with login, or nil if there is none
+func (s *DesiredState) Member(login string) *DesiredMember {
+	for _, m := range s.Members {
+		if strings.EqualFold(m.Login, login) {
+			return m
+		}
+	}
+	return nil
+}
+
+// ManagesMembers reports whether the team's members are listed
+func (t *DesiredTeam) ManagesMembers() bool {
+	return t.Maintainers != nil || t.Members != nil
+}
+
+// ManagesRepos reports whether the team's repositories are listed
+func (t *DesiredTeam) ManagesRepos() bool {
+	return t.Repos != nil
+}
+
+// Roles maps the lowercase logins of the team's members to their team role
+func (t *DesiredTeam) Roles() map[string]string {
+	rs := make(map[string]string)
+	for _, l := range t.Members {
+		rs[strings.ToLower(l)] = "member"
+	}
+	for _, l := range t.Maintainers {
+		rs[strings.ToLower(l)] = "maintainer"
+	}
+	return rs
+}
+
+// Team returns t as a Team, with its members' roles and its repository permissions
+func (t *DesiredTeam) Team() *Team {
+	dt := &Team{
+		Name:            t.Name,
+		Slug:            t.Slug,
+		Description:     t.Description,
+		Privacy:         t.Privacy,
+		Roles:           t.Roles(),
+		RepoPermissions: make(map[string]string),
+	}
+	for r, p := range t.Repos {
+		dt.RepoPermissions[r] = p
+	}
+	return dt
+}
+
+// repoPermissionNames maps the names GitHub accepts for the built in repository
+// permissions to the levels Team.RepoPermission returns
+var repoPermissionNames = map[string]string{
+	"read":     "pull",
+	"pull":     "pull",
+	"triage":   "triage",
+	"write":    "push",
+	"push":     "push",
+	"maintain": "maintain",
+	"admin":    "admin",
+}
+
+// LoadDesiredState loads and validates a desired state JSON file. Roles and
+// permissions are normalised, and team names default to their slug.
+func LoadDesiredState(file string) (*DesiredState, error) {
+	s := new(DesiredState)
+	bd, rerr := ioutil.ReadFile(file)
+	if rerr != nil {
+		return s, rerr
+	}
+	dec := json.NewDecoder(bytes.NewReader(bd))
+	// Reject misspelt keys rather than silently treating their contents as omitted
+	dec.DisallowUnknownFields()
+	if jerr := dec.Decode(s); jerr != nil {
+		return s, fmt.Errorf("%s: %s", file, jerr)
+	}
+	if verr := s.normalise(); verr != nil {
+		return s, fmt.Errorf("%s: %s", file, verr)
+	}
+	return s, nil
+}
+
+// normalise validates s and normalises its roles, permissions and team names
+func (s *DesiredState) normalise() error {
+	members := make(map[string]bool)
+	for _, m := range s.Members {
+		if m.Login == "" {
+			return errors.New("member without login")
+		}
+		if members[strings.ToLower(m.Login)] {
+			return fmt.Errorf("member %s listed more than once", m.Login)
+		}
+		members[strings.ToLower(m.Login)] = true
+		m.Role = strings.ToLower(m.Role)
+		if m.Role == "" {
+			m.Role = "member"
+		}
+		if m.Role != "admin" && m.Role != "member" {
+			return fmt.Errorf("member %s has invalid role %s, must be admin or member", m.Login, m.Role)
+		}
+	}
+	teams := make(map[string]bool)
+	for _, t := range s.Teams {
+		if t.Slug == "" {
+			return errors.New("team without slug")
+		}
+		if teams[t.Slug] {
+			return fmt.Errorf("team %s listed more than once", t.Slug)
+		}
+		teams[t.Slug] = true
+		if t.Name == "" {
+			t.Name = t.Slug
+		}
+		seen := make(map[string]bool)
+		for _, l := range append(append([]string{}, t.Maintainers...), t.Members...) {
+			if seen[strings.ToLower(l)] {
+				return fmt.Errorf("team %s lists %s more than once", t.Slug, l)
+			}
+			seen[strings.ToLower(l)] = true
+			if s.ManagesMembers() && !members[strings.ToLower(l)] {
+				return fmt.Errorf("team %s lists %s, who is not in members", t.Slug, l)
+			}
+		}
+		for r, p := range t.Repos {
+			// Custom repository roles are kept as they are
+			if n, ok := repoPermissionNames[strings.ToLower(p)]; ok {
+				p = n
+			}
+			if p == "" {
+				return fmt.Errorf("team %s has no permission for repo %s", t.Slug, r)
+			}
+			t.Repos[r] = p
+		}
+	}
+	return nil
+}
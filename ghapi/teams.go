@@ -2,13 +2,14 @@ package ghapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 )
 
 // Team contains team data
@@ -31,6 +32,36 @@ type Team struct {
 	UpdatedAt       string        `json:"updated_at"`
 	Organization    Organization  `json:"organization"`
 	Repositories    []*Repository `json:"repositories"`
+	// Roles maps lowercase member logins to their team role, maintainer or member
+	Roles map[string]string `json:"roles,omitempty"`
+	// RepoPermissions maps repository names to the team's permission on them
+	RepoPermissions map[string]string `json:"repo_permissions,omitempty"`
+}
+
+// SetRepositories sets the team's repositories, recording the team's permission on each
+func (t *Team) SetRepositories(rs []*Repository) {
+	t.Repositories = rs
+	t.RepoPermissions = make(map[string]string)
+	for _, r := range rs {
+		t.RepoPermissions[r.Name] = r.Permission()
+	}
+}
+
+// RepoPermission returns the team's permission on r. Teams pulled before
+// permissions were recorded fall back to the permissions pulled with r.
+func (t *Team) RepoPermission(r *Repository) string {
+	if p, ok := t.RepoPermissions[r.Name]; ok {
+		return p
+	}
+	return r.Permission()
+}
+
+// MemberRole returns u's role in the team, defaulting to member if it is not known
+func (t *Team) MemberRole(u *User) string {
+	if r, ok := t.Roles[strings.ToLower(u.Login)]; ok && r != "" {
+		return r
+	}
+	return "member"
 }
 
 // ParentTeam contains a team's parent team data
@@ -47,96 +78,198 @@ type ParentTeam struct {
 	RepositoriesURL string `json:"repositories_url"`
 }
 
-// AllTeams lists all members in org
-func AllTeams() ([]*Team, error) {
-	var lp ListPages
+// AllTeams lists all teams in org
+func (c *Client) AllTeams() ([]*Team, error) {
+	return c.AllTeamsContext(context.Background())
+}
+
+// AllTeamsContext is AllTeams with a context controlling cancellation
+func (c *Client) AllTeamsContext(ctx context.Context) ([]*Team, error) {
 	var ts []*Team
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
-		}
+	pg := c.NewPaginator("/orgs/"+c.Org+"/teams", "application/vnd.github.hellcat-preview+json")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Teams %+v\n", lp)
-		tsl, llp, err := ListTeams(lp.Next)
-		if err != nil {
+		log.Printf("Listing Teams, page %d\n", pg.Page())
+		var tsl []*Team
+		if err := pg.NextContext(ctx, &tsl); err != nil {
 			return ts, err
 		}
 		ts = append(ts, tsl...)
-		if lp.Next == lp.Last && lp.Last > 0 {
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			break
-		}
 	}
 	return ts, nil
 }
 
-// ListTeams lists teams in an organization
-func ListTeams(page int) ([]*Team, ListPages, error) {
-	var tl []*Team
-	var lp ListPages
-	reqURL := "https://api.github.com/orgs/" + Org + "/teams"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
+// CreateTeam creates a team in the org with t's name, description and privacy,
+// nested under the team with ID parentID unless it is 0
+func (c *Client) CreateTeam(t *Team, parentID int) (*Team, error) {
+	return c.CreateTeamContext(context.Background(), t, parentID)
+}
+
+// CreateTeamContext is CreateTeam with a context controlling cancellation
+func (c *Client) CreateTeamContext(ctx context.Context, t *Team, parentID int) (*Team, error) {
+	type params struct {
+		Name         string `json:"name"`
+		Description  string `json:"description,omitempty"`
+		Privacy      string `json:"privacy,omitempty"`
+		ParentTeamID int    `json:"parent_team_id,omitempty"`
+	}
+	ct := new(Team)
+	jd, jerr := json.Marshal(&params{
+		Name:         t.Name,
+		Description:  t.Description,
+		Privacy:      t.Privacy,
+		ParentTeamID: parentID,
+	})
+	if jerr != nil {
+		return ct, jerr
 	}
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := c.newRequest(ctx, "POST", "/orgs/"+c.Org+"/teams", bytes.NewBuffer(jd))
 	if err != nil {
-		return tl, lp, err
+		return ct, err
 	}
-	req.Header.Set("Accept", "application/vnd.github.hellcat-preview+json")
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Create team in org %s: %s\n", c.Org, t.Slug)
+	res, rerr := c.do(req)
 	if rerr != nil {
-		return tl, lp, rerr
+		return ct, rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return ct, berr
+	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return ct, cerr
 	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
+	jerr = json.Unmarshal(bd, ct)
+	if jerr != nil {
+		return ct, jerr
+	}
+	return ct, nil
+}
+
+// AddTeamRepo grants the team with t's slug permission on the org repository named repo.
+// GitHub grants push if permission is empty.
+func (c *Client) AddTeamRepo(t *Team, repo, permission string) error {
+	return c.AddTeamRepoContext(context.Background(), t, repo, permission)
+}
+
+// AddTeamRepoContext is AddTeamRepo with a context controlling cancellation
+func (c *Client) AddTeamRepoContext(ctx context.Context, t *Team, repo, permission string) error {
+	type params struct {
+		Permission string `json:"permission,omitempty"`
+	}
+	jd, jerr := json.Marshal(&params{
+		Permission: permission,
+	})
+	if jerr != nil {
+		return jerr
+	}
+	req, err := c.newRequest(ctx, "PUT", "/orgs/"+c.Org+"/teams/"+t.Slug+"/repos/"+c.Org+"/"+repo, bytes.NewBuffer(jd))
 	if err != nil {
-		return tl, lp, err
+		return err
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return tl, lp, rlerr
+	req.Header.Set("Content-Type", "application/json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Grant team %s %s on repo: %s\n", t.Slug, permission, repo)
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return rerr
 	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
-		return tl, lp, berr
+		return berr
 	}
-	jerr := json.Unmarshal(bd, &tl)
-	if jerr != nil {
-		return tl, lp, jerr
+	return checkResponse(res, bd)
+}
+
+// RemoveTeamRepo removes the access of the team with t's slug to the org repository named repo
+func (c *Client) RemoveTeamRepo(t *Team, repo string) error {
+	return c.RemoveTeamRepoContext(context.Background(), t, repo)
+}
+
+// RemoveTeamRepoContext is RemoveTeamRepo with a context controlling cancellation
+func (c *Client) RemoveTeamRepoContext(ctx context.Context, t *Team, repo string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/orgs/"+c.Org+"/teams/"+t.Slug+"/repos/"+c.Org+"/"+repo, nil)
+	if err != nil {
+		return err
 	}
-	return tl, lp, nil
+	log.SetOutput(os.Stdout)
+	log.Printf("Remove team %s from repo: %s\n", t.Slug, repo)
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
+	}
+	return checkResponse(res, bd)
 }
 
-// GetDetails gets team details for team
-func (t *Team) GetDetails() error {
-	reqURL := "https://api.github.com/teams/" + strconv.Itoa(t.ID)
-	req, err := http.NewRequest("GET", reqURL, nil)
+// ParentFirst orders ts so that every team comes after its parent. Teams whose
+// parent is not in ts are treated as top level.
+func ParentFirst(ts []*Team) []*Team {
+	in := make(map[string]bool)
+	for _, t := range ts {
+		in[t.Slug] = true
+	}
+	var sorted []*Team
+	placed := make([]bool, len(ts))
+	created := make(map[string]bool)
+	for len(sorted) < len(ts) {
+		n := len(sorted)
+		for i, t := range ts {
+			if placed[i] {
+				continue
+			}
+			if p := t.Parent.Slug; p == "" || !in[p] || created[p] {
+				sorted = append(sorted, t)
+				placed[i] = true
+				created[t.Slug] = true
+			}
+		}
+		if len(sorted) == n {
+			// A parent cycle, keep the remaining teams in their original order
+			for i, t := range ts {
+				if !placed[i] {
+					sorted = append(sorted, t)
+					placed[i] = true
+				}
+			}
+		}
+	}
+	return sorted
+}
+
+// GetTeamDetails gets team details for team
+func (c *Client) GetTeamDetails(t *Team) error {
+	return c.GetTeamDetailsContext(context.Background(), t)
+}
+
+// GetTeamDetailsContext is GetTeamDetails with a context controlling cancellation
+func (c *Client) GetTeamDetailsContext(ctx context.Context, t *Team) error {
+	req, err := c.newRequest(ctx, "GET", "/teams/"+strconv.Itoa(t.ID), nil)
 	if err != nil {
 		return err
 	}
 	log.SetOutput(os.Stdout)
 	log.Printf("Get full details for team: %s\n", t.Name)
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return rerr
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rlerr
-	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
 		return berr
 	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return cerr
+	}
 	jerr := json.Unmarshal(bd, &t)
 	if jerr != nil {
 		return jerr
@@ -144,178 +277,336 @@ func (t *Team) GetDetails() error {
 	return nil
 }
 
-// AllMembers lists all members in team
-func (t *Team) AllMembers() ([]*User, error) {
-	var lp ListPages
-	var us []*User
-	for lp.Next <= lp.Last {
-		if lp.Next == 0 {
-			lp.Next = 1
+// GetAllTeamDetails gets details, repositories and members for every team in ts
+func (c *Client) GetAllTeamDetails(ts []*Team) error {
+	return c.GetAllTeamDetailsContext(context.Background(), ts)
+}
+
+// GetAllTeamDetailsContext is GetAllTeamDetails with a context controlling cancellation
+func (c *Client) GetAllTeamDetailsContext(ctx context.Context, ts []*Team) error {
+	// Read the local user details once for all teams rather than for every member
+	lus, lerr := c.localUsers()
+	if lerr != nil {
+		return lerr
+	}
+	return c.forEach(ctx, len(ts), func(ctx context.Context, i int) error {
+		t := ts[i]
+		derr := c.GetTeamDetailsContext(ctx, t)
+		if derr != nil {
+			return derr
 		}
+		trs, terr := c.TeamRepositoriesContext(ctx, t)
+		if terr != nil {
+			return terr
+		}
+		tms, merr := c.teamMembers(ctx, t, lus)
+		if merr != nil {
+			return merr
+		}
+		t.SetRepositories(trs)
+		t.Members = tms
+		return nil
+	})
+}
+
+// AllTeamMembers lists all members in team, including the members of its child teams
+func (c *Client) AllTeamMembers(t *Team) ([]*User, error) {
+	return c.AllTeamMembersContext(context.Background(), t)
+}
+
+// AllTeamMembersContext is AllTeamMembers with a context controlling cancellation
+func (c *Client) AllTeamMembersContext(ctx context.Context, t *Team) ([]*User, error) {
+	lus, lerr := c.localUsers()
+	if lerr != nil {
+		return nil, lerr
+	}
+	return c.teamMembers(ctx, t, lus)
+}
+
+// teamMembers lists all members in team with their details in lus, the local
+// users keyed by ID, and records their team roles
+func (c *Client) teamMembers(ctx context.Context, t *Team, lus map[int]*User) ([]*User, error) {
+	var us []*User
+	pg := c.NewPaginator("/teams/"+strconv.Itoa(t.ID)+"/members", "")
+	for pg.More() {
 		log.SetOutput(os.Stdout)
-		log.Printf("Listing Members in Team %s %+v\n", t.Name, lp)
-		usl, llp, err := t.ListMembers(lp.Next)
-		if err != nil {
+		log.Printf("Listing Members in Team %s, page %d\n", t.Name, pg.Page())
+		var usl []*User
+		if err := pg.NextContext(ctx, &usl); err != nil {
 			return us, err
 		}
 		us = append(us, usl...)
-		if lp.Next == lp.Last && lp.Last > 0 {
-			us = append(us, usl...)
-			break
-		}
-		lp = llp
-		if lp.Last == 0 {
-			us = append(us, usl...)
-			break
-		}
 	}
-	var lus []*User
+	var tms []*User
 	for _, u := range us {
-		ud, uerr := u.GetDetailsLocal()
-		if uerr != nil {
-			return us, uerr
+		if lu, ok := lus[u.ID]; ok {
+			u = lu
 		}
-		u = ud
-		lus = append(lus, ud)
+		tms = append(tms, u)
+	}
+	mus, merr := c.TeamMaintainersContext(ctx, t)
+	if merr != nil {
+		return tms, merr
+	}
+	t.Roles = make(map[string]string)
+	for _, u := range tms {
+		t.Roles[strings.ToLower(u.Login)] = "member"
+	}
+	for _, u := range mus {
+		t.Roles[strings.ToLower(u.Login)] = "maintainer"
 	}
-	t.Members = lus
-	return lus, nil
+	t.Members = tms
+	return tms, nil
 }
 
-// ListMembers lists members in a team
-func (t *Team) ListMembers(page int) ([]*User, ListPages, error) {
-	var ul []*User
-	var lp ListPages
-	reqURL := "https://api.github.com/teams/" + strconv.Itoa(t.ID) + "/members"
-	if page > 0 {
-		reqURL += "?page=" + strconv.Itoa(page)
-	}
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return ul, lp, err
+// TeamMaintainers lists the members of team with the maintainer role
+func (c *Client) TeamMaintainers(t *Team) ([]*User, error) {
+	return c.TeamMaintainersContext(context.Background(), t)
+}
+
+// TeamMaintainersContext is TeamMaintainers with a context controlling cancellation
+func (c *Client) TeamMaintainersContext(ctx context.Context, t *Team) ([]*User, error) {
+	var us []*User
+	pg := c.NewPaginator("/teams/"+strconv.Itoa(t.ID)+"/members?role=maintainer", "")
+	for pg.More() {
+		log.SetOutput(os.Stdout)
+		log.Printf("Listing Maintainers in Team %s, page %d\n", t.Name, pg.Page())
+		var usl []*User
+		if err := pg.NextContext(ctx, &usl); err != nil {
+			return us, err
+		}
+		us = append(us, usl...)
 	}
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
-	if rerr != nil {
-		return ul, lp, rerr
+	return us, nil
+}
+
+// SaveTeamList saves a member list to a JSON file
+func (c *Client) SaveTeamList(ts []*Team) error {
+	teamListFile := path.Join(c.DataDir, "teams.json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Saving team list to: %s\n", teamListFile)
+	jd, jerr := json.Marshal(ts)
+	if jerr != nil {
+		return jerr
 	}
-	links := res.Header.Get("Link")
-	lp, err = parseLinks(links)
+	return writeDataFile(teamListFile, jd)
+}
+
+// TeamMembership contains a user's membership of a team
+type TeamMembership struct {
+	URL string `json:"url"`
+	// Role is maintainer or member
+	Role string `json:"role"`
+	// State is active, or pending until the user accepts their org invitation
+	State string `json:"state"`
+}
+
+// GetTeamMembership gets u's membership of the team with t's slug, failing with a not found
+// APIError if u is not a member
+func (c *Client) GetTeamMembership(t *Team, u *User) (*TeamMembership, error) {
+	return c.GetTeamMembershipContext(context.Background(), t, u)
+}
+
+// GetTeamMembershipContext is GetTeamMembership with a context controlling cancellation
+func (c *Client) GetTeamMembershipContext(ctx context.Context, t *Team, u *User) (*TeamMembership, error) {
+	tm := new(TeamMembership)
+	req, err := c.newRequest(ctx, "GET", "/orgs/"+c.Org+"/teams/"+t.Slug+"/memberships/"+u.Login, nil)
 	if err != nil {
-		return ul, lp, err
+		return tm, err
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return ul, lp, rlerr
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return tm, rerr
 	}
 	defer res.Body.Close()
 	bd, berr := ioutil.ReadAll(res.Body)
 	if berr != nil {
-		return ul, lp, berr
+		return tm, berr
+	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return tm, cerr
 	}
-	jerr := json.Unmarshal(bd, &ul)
+	jerr := json.Unmarshal(bd, tm)
 	if jerr != nil {
-		return ul, lp, jerr
+		return tm, jerr
 	}
-	return ul, lp, nil
+	return tm, nil
 }
 
-// SaveTeamList saves a member list to a JSON file
-func SaveTeamList(ts []*Team) error {
-	teamListFile := path.Join(DataDir, "teams.json")
-	os.Remove(teamListFile)
-	log.SetOutput(os.Stdout)
-	log.Printf("Saving team list to: %s\n", teamListFile)
-	jd, jerr := json.Marshal(ts)
-	if jerr != nil {
-		return jerr
-	}
-	return ioutil.WriteFile(teamListFile, jd, 0755)
+// InviteMemberToTeam invites user to team with their role in the local team list
+func (c *Client) InviteMemberToTeam(m *Membership, t *Team) error {
+	return c.InviteMemberToTeamContext(context.Background(), m, t)
 }
 
-// InviteMemberToTeam invites user to org
-func (m *Membership) InviteMemberToTeam(t *Team) error {
-	reqURL := "https://api.github.com/teams/" + strconv.Itoa(t.ID) + "/memberships/" + m.User.Login
+// InviteMemberToTeamContext is InviteMemberToTeam with a context controlling cancellation
+func (c *Client) InviteMemberToTeamContext(ctx context.Context, m *Membership, t *Team) error {
 	type params struct {
 		Role string `json:"role"`
 	}
+	// m.Role is the org role, team roles are maintainer or member
 	p := &params{
-		Role: m.Role,
+		Role: t.MemberRole(&m.User),
 	}
 	jd, jerr := json.Marshal(&p)
 	if jerr != nil {
 		return jerr
 	}
-	req, err := http.NewRequest("PUT", reqURL, bytes.NewBuffer(jd))
+	// Addressed by slug so that a team pulled from another org maps to the team of the same slug in c.Org
+	req, err := c.newRequest(ctx, "PUT", "/orgs/"+c.Org+"/teams/"+t.Slug+"/memberships/"+m.User.Login, bytes.NewBuffer(jd))
 	if err != nil {
 		return err
 	}
 	log.SetOutput(os.Stdout)
-	log.Printf("Invite user %s to team: %s\n", m.User.Login, t.Name)
-	req.Header.Set("Authorization", "token "+Token)
-	c := &http.Client{}
-	res, rerr := c.Do(req)
+	log.Printf("Invite user %s to team %s as: %s\n", m.User.Login, t.Name, p.Role)
+	res, rerr := c.do(req)
 	if rerr != nil {
 		return rerr
 	}
-	_, rlerr := ParseRateLimit(res)
-	if rlerr != nil {
-		return rlerr
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
 	}
-	return nil
+	return checkResponse(res, bd)
 }
 
-// TeamIDs returns team IDs for a membership
-func (m *Membership) TeamIDs() ([]int, error) {
-	var ids []int
-	teamListFile := path.Join(DataDir, "teams.json")
-	if _, cerr := os.Stat(teamListFile); os.IsNotExist(cerr) {
-		log.Println(teamListFile, "does not exist")
-		return ids, cerr
+// RemoveTeamMember removes u from the team with t's slug, leaving their org membership as it is
+func (c *Client) RemoveTeamMember(t *Team, u *User) error {
+	return c.RemoveTeamMemberContext(context.Background(), t, u)
+}
+
+// RemoveTeamMemberContext is RemoveTeamMember with a context controlling cancellation
+func (c *Client) RemoveTeamMemberContext(ctx context.Context, t *Team, u *User) error {
+	req, err := c.newRequest(ctx, "DELETE", "/orgs/"+c.Org+"/teams/"+t.Slug+"/memberships/"+u.Login, nil)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(os.Stdout)
+	log.Printf("Remove user %s from team: %s\n", u.Login, t.Slug)
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
 	}
-	fd, ferr := ioutil.ReadFile(teamListFile)
-	if ferr != nil {
-		return ids, ferr
+	return checkResponse(res, bd)
+}
+
+// LoadTeams loads the team list from the local data file
+func (c *Client) LoadTeams() ([]*Team, error) {
+	if c.snapshot != nil {
+		return c.snapshot.Teams, nil
 	}
 	var ts []*Team
-	jerr := json.Unmarshal(fd, &ts)
-	if jerr != nil {
-		return ids, jerr
+	err := c.loadDataFile("teams.json", &ts)
+	return ts, err
+}
+
+// UserTeams returns the teams in the local team list that u is a member of
+func (c *Client) UserTeams(u *User) ([]*Team, error) {
+	var uts []*Team
+	ts, err := c.LoadTeams()
+	if err != nil {
+		return uts, err
 	}
 	for _, t := range ts {
-		for _, u := range t.Members {
-			if u.ID == m.User.ID {
-				ids = append(ids, t.ID)
+		for _, tu := range t.Members {
+			if (u.ID != 0 && tu.ID == u.ID) || strings.EqualFold(tu.Login, u.Login) {
+				uts = append(uts, t)
+				break
 			}
 		}
 	}
+	return uts, nil
+}
+
+// TeamIDs returns team IDs for a membership. If MapTeams has been called the
+// IDs are those of the teams with the same slugs in c.Org, and teams missing
+// from c.Org are left out.
+func (c *Client) TeamIDs(m *Membership) ([]int, error) {
+	var ids []int
+	ts, err := c.UserTeams(&m.User)
+	if err != nil {
+		return ids, err
+	}
+	for _, t := range ts {
+		if c.teamIDs == nil {
+			ids = append(ids, t.ID)
+		} else if id, ok := c.teamIDs[t.Slug]; ok {
+			ids = append(ids, id)
+		} else {
+			log.Printf("Team %s not found in org %s, not inviting %s to it\n", t.Slug, c.Org, m.User.Login)
+		}
+	}
 	return ids, nil
 }
 
-// InviteUsersToTeams invites all users defined in teams file back to team
-func InviteUsersToTeams() error {
-	teamListFile := path.Join(DataDir, "teams.json")
-	if _, cerr := os.Stat(teamListFile); os.IsNotExist(cerr) {
-		log.Println(teamListFile, "does not exist")
-		return cerr
+// MapTeams lists the teams of c.Org so that TeamIDs maps teams in the local
+// team list, pulled from another org, to the teams with the same slugs
+func (c *Client) MapTeams() error {
+	return c.MapTeamsContext(context.Background())
+}
+
+// MapTeamsContext is MapTeams with a context controlling cancellation
+func (c *Client) MapTeamsContext(ctx context.Context) error {
+	ts, err := c.AllTeamsContext(ctx)
+	if err != nil {
+		return err
+	}
+	c.teamIDs = make(map[string]int)
+	for _, t := range ts {
+		c.teamIDs[t.Slug] = t.ID
+	}
+	return nil
+}
+
+// RestoreTeamMemberships adds u back to every team it is a member of in the local team list,
+// as maintainer or member as it was when pulled
+func (c *Client) RestoreTeamMemberships(u *User) error {
+	return c.RestoreTeamMembershipsContext(context.Background(), u)
+}
+
+// RestoreTeamMembershipsContext is RestoreTeamMemberships with a context controlling cancellation
+func (c *Client) RestoreTeamMembershipsContext(ctx context.Context, u *User) error {
+	ts, err := c.UserTeams(u)
+	if err != nil {
+		return err
 	}
-	fd, ferr := ioutil.ReadFile(teamListFile)
-	if ferr != nil {
-		return ferr
+	m := &Membership{
+		User: *u,
 	}
-	var ts []*Team
-	jerr := json.Unmarshal(fd, &ts)
-	if jerr != nil {
-		return jerr
+	for _, t := range ts {
+		ierr := c.InviteMemberToTeamContext(ctx, m, t)
+		if IsNotFound(ierr) {
+			log.Printf("Team %s not found in org %s, skipping\n", t.Slug, c.Org)
+		} else if ierr != nil {
+			return ierr
+		}
+	}
+	return nil
+}
+
+// InviteUsersToTeams invites all users defined in teams file back to team
+func (c *Client) InviteUsersToTeams() error {
+	return c.InviteUsersToTeamsContext(context.Background())
+}
+
+// InviteUsersToTeamsContext is InviteUsersToTeams with a context controlling cancellation
+func (c *Client) InviteUsersToTeamsContext(ctx context.Context) error {
+	ts, err := c.LoadTeams()
+	if err != nil {
+		return err
 	}
 	for _, t := range ts {
 		for _, u := range t.Members {
-			m, merr := u.GetLocalMembership()
+			m, merr := c.GetLocalMembership(u)
 			if merr != nil {
 				return merr
 			}
-			ierr := m.InviteMemberToTeam(t)
+			ierr := c.InviteMemberToTeamContext(ctx, m, t)
 			if ierr != nil {
 				return ierr
 			}
@@ -0,0 +1,108 @@
+package ghapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// team returns a team with slug, and parent if it is not empty
+func team(slug, parent string) *Team {
+	t := &Team{
+		Name: slug,
+		Slug: slug,
+	}
+	t.Parent.Slug = parent
+	return t
+}
+
+func TestParentFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   []*Team
+		want string
+	}{
+		{"empty", nil, ""},
+		{"top level keeps order", []*Team{team("b", ""), team("a", ""), team("c", "")}, "b a c"},
+		{"already ordered", []*Team{team("a", ""), team("b", "a"), team("c", "b")}, "a b c"},
+		{"multi level", []*Team{team("c", "b"), team("b", "a"), team("d", ""), team("a", "")}, "d a b c"},
+		{"siblings keep order", []*Team{team("y", "p"), team("x", "p"), team("p", "")}, "p y x"},
+		{"missing parent is top level", []*Team{team("c", "b"), team("b", "gone")}, "b c"},
+		{"cycle keeps order", []*Team{team("x", "y"), team("y", "x"), team("a", "")}, "a x y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, st := range ParentFirst(tt.ts) {
+				got = append(got, st.Slug)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ParentFirst() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParentFirstKeepsInput(t *testing.T) {
+	ts := []*Team{team("c", "b"), team("b", "a"), team("a", "")}
+	in := append([]*Team{}, ts...)
+	ParentFirst(ts)
+	if !reflect.DeepEqual(ts, in) {
+		t.Error("ParentFirst() reordered its input")
+	}
+}
+
+func TestGetAllTeamDetails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/teams/1" || r.URL.Path == "/teams/2":
+			fmt.Fprintf(w, `{"id":%s,"slug":"team%s","name":"Team %s"}`, r.URL.Path[7:], r.URL.Path[7:], r.URL.Path[7:])
+		case strings.HasSuffix(r.URL.Path, "/repos"):
+			fmt.Fprint(w, `[{"name":"api","permissions":{"pull":true,"push":true}}]`)
+		case r.URL.Path == "/teams/1/members" && r.URL.Query().Get("role") == "maintainer":
+			fmt.Fprint(w, `[{"login":"alice","id":1}]`)
+		case r.URL.Path == "/teams/1/members":
+			fmt.Fprint(w, `[{"login":"alice","id":1},{"login":"bob","id":2},{"login":"new","id":3}]`)
+		case r.URL.Path == "/teams/2/members":
+			fmt.Fprint(w, `[]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	dir, derr := ioutil.TempDir("", "ghapi")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	c := newTestClient(srv)
+	c.DataDir = dir
+	c.Concurrency = 2
+	if err := c.SaveMemberList([]*User{
+		{Login: "alice", ID: 1, Email: "alice@example.com"},
+		{Login: "bob", ID: 2, Email: "bob@example.com"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ts := []*Team{{ID: 1}, {ID: 2}}
+	if err := c.GetAllTeamDetails(ts); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, u := range ts[0].Members {
+		got = append(got, u.Login+" "+u.Email+" "+ts[0].MemberRole(u))
+	}
+	// Members missing from users.json are kept as the API listed them
+	want := []string{"alice alice@example.com maintainer", "bob bob@example.com member", "new  member"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("team1 members = %q, want %q", got, want)
+	}
+	if ts[1].Slug != "team2" || len(ts[1].Members) != 0 || ts[1].RepoPermission(ts[1].Repositories[0]) != "push" {
+		t.Errorf("team2 = %+v, want no members and push on api", ts[1])
+	}
+}
@@ -0,0 +1,170 @@
+package ghapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// GetRepository gets the org repository named name
+func (c *Client) GetRepository(name string) (*Repository, error) {
+	return c.GetRepositoryContext(context.Background(), name)
+}
+
+// GetRepositoryContext is GetRepository with a context controlling cancellation
+func (c *Client) GetRepositoryContext(ctx context.Context, name string) (*Repository, error) {
+	r := new(Repository)
+	req, err := c.newRequest(ctx, "GET", "/repos/"+c.Org+"/"+name, nil)
+	if err != nil {
+		return r, err
+	}
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return r, rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return r, berr
+	}
+	if cerr := checkResponse(res, bd); cerr != nil {
+		return r, cerr
+	}
+	jerr := json.Unmarshal(bd, r)
+	if jerr != nil {
+		return r, jerr
+	}
+	return r, nil
+}
+
+// WaitForRepository waits for the org repository named name to exist, as it
+// does not straight away after a transfer, backing off per the retry policy
+func (c *Client) WaitForRepository(name string) (*Repository, error) {
+	return c.WaitForRepositoryContext(context.Background(), name)
+}
+
+// WaitForRepositoryContext is WaitForRepository with a context controlling cancellation
+func (c *Client) WaitForRepositoryContext(ctx context.Context, name string) (*Repository, error) {
+	for attempt := 1; ; attempt++ {
+		r, err := c.GetRepositoryContext(ctx, name)
+		if !IsNotFound(err) || !c.Retry.retry(attempt) {
+			return r, err
+		}
+		log.Printf("Repo %s not yet in org %s, checking again\n", name, c.Org)
+		if serr := sleep(ctx, c.Retry.Backoff(attempt)); serr != nil {
+			return r, serr
+		}
+	}
+}
+
+// TransferRepository transfers r to the org newOwner, renaming it to newName unless it is empty.
+// GitHub completes the transfer asynchronously.
+func (c *Client) TransferRepository(r *Repository, newOwner, newName string) error {
+	return c.TransferRepositoryContext(context.Background(), r, newOwner, newName)
+}
+
+// TransferRepositoryContext is TransferRepository with a context controlling cancellation
+func (c *Client) TransferRepositoryContext(ctx context.Context, r *Repository, newOwner, newName string) error {
+	type params struct {
+		NewOwner string `json:"new_owner"`
+		NewName  string `json:"new_name,omitempty"`
+	}
+	jd, jerr := json.Marshal(&params{
+		NewOwner: newOwner,
+		NewName:  newName,
+	})
+	if jerr != nil {
+		return jerr
+	}
+	req, err := c.newRequest(ctx, "POST", "/repos/"+c.Org+"/"+r.Name+"/transfer", bytes.NewBuffer(jd))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	log.SetOutput(os.Stdout)
+	log.Printf("Transfer repo %s to org: %s\n", r.Name, newOwner)
+	res, rerr := c.do(req)
+	if rerr != nil {
+		return rerr
+	}
+	defer res.Body.Close()
+	bd, berr := ioutil.ReadAll(res.Body)
+	if berr != nil {
+		return berr
+	}
+	return checkResponse(res, bd)
+}
+
+// TeamAccess records the re-attachment of a team to a transferred repository
+type TeamAccess struct {
+	Slug       string `json:"slug"`
+	Permission string `json:"permission"`
+	Done       bool   `json:"done"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TransferRecord records the outcome of transferring a repository
+type TransferRecord struct {
+	Repository string `json:"repository"`
+	// NewName is the name in the target org, which differs if it was renamed on conflict
+	NewName     string        `json:"new_name"`
+	TargetOrg   string        `json:"target_org"`
+	Transferred bool          `json:"transferred"`
+	Teams       []*TeamAccess `json:"teams,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	At          time.Time     `json:"at"`
+}
+
+// Done reports whether the repository was transferred and all its teams re-attached
+func (r *TransferRecord) Done() bool {
+	if !r.Transferred {
+		return false
+	}
+	for _, ta := range r.Teams {
+		if !ta.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadTransfers loads transfer records from the local data file, keyed by source repository name
+func (c *Client) LoadTransfers() (map[string]*TransferRecord, error) {
+	trs := make(map[string]*TransferRecord)
+	bd, rerr := ioutil.ReadFile(path.Join(c.DataDir, "transfers.json"))
+	if os.IsNotExist(rerr) {
+		return trs, nil
+	} else if rerr != nil {
+		return trs, rerr
+	}
+	var tl []*TransferRecord
+	if jerr := json.Unmarshal(bd, &tl); jerr != nil {
+		return trs, jerr
+	}
+	for _, tr := range tl {
+		trs[tr.Repository] = tr
+	}
+	return trs, nil
+}
+
+// SaveTransfers saves transfer records to transfers.json in the data directory
+func (c *Client) SaveTransfers(trs map[string]*TransferRecord) error {
+	var tl []*TransferRecord
+	for _, tr := range trs {
+		tl = append(tl, tr)
+	}
+	sort.Slice(tl, func(i, j int) bool {
+		return tl[i].Repository < tl[j].Repository
+	})
+	jd, jerr := json.Marshal(tl)
+	if jerr != nil {
+		return jerr
+	}
+	return writeDataFile(path.Join(c.DataDir, "transfers.json"), jd)
+}